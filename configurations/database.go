@@ -10,21 +10,25 @@ import (
 	_ "github.com/lib/pq"
 )
 
-func DBConnection() (*sql.DB, error) {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
+// DBConnectionString builds the postgres connection string from the environment
+func DBConnectionString() string {
 	dbHost := os.Getenv("DB_HOST")
 	dbPort := os.Getenv("DB_PORT")
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
 	dbName := os.Getenv("DB_NAME")
 	// Buat string koneksi database
-	dbConnectionString := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		dbUser, dbPassword, dbHost, dbPort, dbName)
+}
+
+func DBConnection() (*sql.DB, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
 
 	// Buat koneksi ke database
-	db, err := sql.Open("postgres", dbConnectionString)
+	db, err := sql.Open("postgres", DBConnectionString())
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
@@ -1,15 +1,50 @@
 package configurations
 
 import (
+	"database/sql"
 	"fmt"
+	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 )
 
-var JWTSecret string = os.Getenv("DB_HOST")
+// JWTSecret signs every token, it is read from JWT_SECRET by LoadJWTSecret
+var JWTSecret string
+
+// LoadJWTSecret reads JWT_SECRET once the env file is loaded. Tokens carry the
+// role of the user, so the server must not start without a secret.
+func LoadJWTSecret() error {
+	JWTSecret = os.Getenv("JWT_SECRET")
+	if JWTSecret == "" {
+		return fmt.Errorf("JWT_SECRET is not set")
+	}
+	return nil
+}
+
+// jwtKey is the key function of every parsed token, only HS256 tokens signed
+// with JWTSecret are accepted
+func jwtKey(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	if JWTSecret == "" {
+		return nil, fmt.Errorf("JWT_SECRET is not set")
+	}
+	return []byte(JWTSecret), nil
+}
+
+// revocationDB is used to refuse access tokens issued before the
+// token_expired_at of their user, or of a suspended user, see SetRevocationDB
+var revocationDB *sql.DB
+
+// SetRevocationDB enables the session revocation check of access tokens
+func SetRevocationDB(db *sql.DB) {
+	revocationDB = db
+}
 
 func GetUserFromToken(c *gin.Context) (int, error) {
 	token := c.GetHeader("Authorization")
@@ -23,12 +58,13 @@ func GetUserFromToken(c *gin.Context) (int, error) {
 
 	// Parse the token
 	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(JWTSecret), nil // Change this to your secret key
-	})
+	_, err := jwt.ParseWithClaims(token, claims, jwtKey)
 	if err != nil {
 		return 0, fmt.Errorf("invalid bearer token: %v", err)
 	}
+	if err := checkAccessClaims(claims); err != nil {
+		return 0, err
+	}
 
 	// Extract the user ID from claims
 	userIDFloat, ok := claims["user_id"].(float64)
@@ -44,11 +80,13 @@ func GetUserFromToken(c *gin.Context) (int, error) {
 	return userID, nil
 }
 
-func GenerateToken(email string, userID int) (string, error) {
+func GenerateToken(email string, userID int, role string) (string, error) {
 	// Create the Claims
 	claims := jwt.MapClaims{
 		"email":   email,
 		"user_id": userID,                               // Add user ID to the claims
+		"role":    role,                                 // Checked by RequireRole
+		"iat":     time.Now().Unix(),                    // Used to revoke the sessions of the user
 		"exp":     time.Now().Add(time.Hour * 8).Unix(), // Token expiration time, adjust as needed
 	}
 
@@ -77,13 +115,125 @@ func CheckBearerToken(c *gin.Context) error {
 
 	// Parse the token
 	claims := jwt.MapClaims{}
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(JWTSecret), nil // Change this to your secret key
-	})
+	_, err := jwt.ParseWithClaims(token, claims, jwtKey)
 	if err != nil {
 		return fmt.Errorf("invalid bearer token: %v", err)
 	}
+	if err := checkAccessClaims(claims); err != nil {
+		return err
+	}
 
 	// Token is valid
 	return nil
 }
+
+// getClaimsFromToken parses the bearer token and returns its claims
+func getClaimsFromToken(c *gin.Context) (jwt.MapClaims, error) {
+	token := c.GetHeader("Authorization")
+	if !strings.HasPrefix(token, "Bearer ") {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(strings.TrimPrefix(token, "Bearer "), claims, jwtKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bearer token: %v", err)
+	}
+	if err := checkAccessClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// checkAccessClaims refuses single purpose tokens, like email verification
+// links, when they are used as access tokens, and tokens issued before the
+// sessions of the user were revoked
+func checkAccessClaims(claims jwt.MapClaims) error {
+	if _, ok := claims["purpose"]; ok {
+		return fmt.Errorf("invalid bearer token: not an access token")
+	}
+	userID, _ := claims["user_id"].(float64)
+	issuedAt, _ := claims["iat"].(float64)
+	return CheckSession(int(userID), time.Unix(int64(issuedAt), 0))
+}
+
+// CheckSession returns an error when the sessions of the user were revoked
+// after issuedAt, or the account is suspended. Long-lived connections call
+// it again to end once the session is no longer valid.
+func CheckSession(userID int, issuedAt time.Time) error {
+	if revocationDB == nil {
+		return nil
+	}
+
+	// token_expired_at is a TIMESTAMP written with NOW() in the time zone of
+	// the session, it is compared in SQL so it is read in the same time zone
+	var revoked, suspended bool
+	err := revocationDB.QueryRow(`SELECT COALESCE(to_timestamp($2) < date_trunc('second', token_expired_at), false), suspended_at IS NOT NULL
+		FROM users WHERE id = $1`, userID, issuedAt.Unix()).Scan(&revoked, &suspended)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("invalid bearer token: unknown user")
+	} else if err != nil {
+		log.Println("Error checking token revocation:", err)
+		return fmt.Errorf("invalid bearer token: %v", err)
+	}
+	if revoked {
+		return fmt.Errorf("invalid bearer token: session revoked")
+	}
+	if suspended {
+		return fmt.Errorf("invalid bearer token: account suspended")
+	}
+	return nil
+}
+
+// GeneratePurposeToken signs a token that can only be used for the given
+// purpose. jti identifies the token so it can be used only once.
+func GeneratePurposeToken(userID int, purpose, jti string, ttl time.Duration) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": purpose,
+		"jti":     jti,
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(ttl).Unix(),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(JWTSecret))
+}
+
+// ParsePurposeToken validates a token created by GeneratePurposeToken and
+// returns its user ID and jti
+func ParsePurposeToken(token, purpose string) (int, string, error) {
+	userID, jti, _, err := parsePurposeToken(token, purpose)
+	return userID, jti, err
+}
+
+// ParsePurposeTokenIssuedAt is ParsePurposeToken for tokens standing in for
+// a session, it returns when the token was issued to check the session with
+func ParsePurposeTokenIssuedAt(token, purpose string) (int, time.Time, error) {
+	userID, _, issuedAt, err := parsePurposeToken(token, purpose)
+	if err == nil && issuedAt.IsZero() {
+		err = fmt.Errorf("invalid token claims")
+	}
+	return userID, issuedAt, err
+}
+
+func parsePurposeToken(token, purpose string) (int, string, time.Time, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, jwtKey)
+	if err != nil {
+		return 0, "", time.Time{}, fmt.Errorf("invalid token: %v", err)
+	}
+	if claims["purpose"] != purpose {
+		return 0, "", time.Time{}, fmt.Errorf("invalid token purpose")
+	}
+
+	userIDFloat, ok := claims["user_id"].(float64)
+	jti, _ := claims["jti"].(string)
+	if !ok || jti == "" {
+		return 0, "", time.Time{}, fmt.Errorf("invalid token claims")
+	}
+	var issuedAt time.Time
+	if iat, ok := claims["iat"].(float64); ok {
+		issuedAt = time.Unix(int64(iat), 0)
+	}
+	return int(userIDFloat), jti, issuedAt, nil
+}
@@ -0,0 +1,88 @@
+package configurations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestParsePurposeTokenSigningMethod(t *testing.T) {
+	JWTSecret = "test-secret"
+	defer func() { JWTSecret = "" }()
+
+	claims := jwt.MapClaims{
+		"user_id": 7,
+		"purpose": "test",
+		"jti":     "abc",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	}
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    interface{}
+		valid  bool
+	}{
+		{"HS256", jwt.SigningMethodHS256, []byte("test-secret"), true},
+		{"HS512", jwt.SigningMethodHS512, []byte("test-secret"), false},
+		{"wrong secret", jwt.SigningMethodHS256, []byte("other"), false},
+		{"none", jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.NewWithClaims(tt.method, claims).SignedString(tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			userID, jti, err := ParsePurposeToken(token, "test")
+			if tt.valid && (err != nil || userID != 7 || jti != "abc") {
+				t.Errorf("ParsePurposeToken() = %d, %q, %v, want 7, \"abc\", nil", userID, jti, err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("ParsePurposeToken() accepted the token")
+			}
+		})
+	}
+}
+
+func TestJWTKeyRequiresSecret(t *testing.T) {
+	JWTSecret = ""
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"purpose": "test"}).SignedString([]byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParsePurposeToken(token, "test"); err == nil {
+		t.Error("ParsePurposeToken() accepted a token signed with an empty secret")
+	}
+}
+
+func TestParsePurposeTokenIssuedAt(t *testing.T) {
+	JWTSecret = "test-secret"
+	defer func() { JWTSecret = "" }()
+
+	token, err := GeneratePurposeToken(7, "test", "abc", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, issuedAt, err := ParsePurposeTokenIssuedAt(token, "test")
+	if err != nil || userID != 7 || time.Since(issuedAt) > time.Minute {
+		t.Errorf("ParsePurposeTokenIssuedAt() = %d, %v, %v, want 7 issued just now", userID, issuedAt, err)
+	}
+
+	// Tokens without an issue time cannot be checked against the session
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": 7,
+		"purpose": "test",
+		"jti":     "abc",
+		"exp":     time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParsePurposeTokenIssuedAt(legacy, "test"); err == nil {
+		t.Error("ParsePurposeTokenIssuedAt() accepted a token without iat")
+	}
+	if _, _, err := ParsePurposeToken(legacy, "test"); err != nil {
+		t.Errorf("ParsePurposeToken() of a token without iat error: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package configurations
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists the roles a user can have
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// GetRoleFromToken returns the role claim of the bearer token. Tokens issued
+// before roles existed belong to regular users.
+func GetRoleFromToken(c *gin.Context) (string, error) {
+	claims, err := getClaimsFromToken(c)
+	if err != nil {
+		return "", err
+	}
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = RoleUser
+	}
+	return role, nil
+}
+
+// IsAdmin reports whether the bearer token belongs to an admin
+func IsAdmin(c *gin.Context) bool {
+	role, err := GetRoleFromToken(c)
+	return err == nil && role == RoleAdmin
+}
+
+// RequireRole is a middleware refusing requests whose bearer token does not
+// have one of the given roles. Changing the role of a user revokes their
+// tokens so the claim is always current.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := GetRoleFromToken(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	}
+}
@@ -0,0 +1,486 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/maintenance"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// parsePagination reads the limit and offset query parameters, it answers
+// the request itself when they are invalid
+func parsePagination(c *gin.Context) (int, int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, must be between 1 and 100"})
+		return 0, 0, false
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+func formatNullTime(t sql.NullTime) interface{} {
+	if !t.Valid {
+		return nil
+	}
+	return t.Time.Format(time.RFC3339)
+}
+
+func AdminGetUsers(c *gin.Context) {
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	query := " FROM users WHERE 1=1"
+	args := []interface{}{}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if role := c.Query("role"); role != "" {
+		query += " AND role = " + addArg(role)
+	}
+	if search := strings.TrimSpace(c.Query("search")); search != "" {
+		pattern := addArg("%" + search + "%")
+		query += " AND (email ILIKE " + pattern + " OR name ILIKE " + pattern + ")"
+	}
+	if suspendedStr := c.Query("suspended"); suspendedStr != "" {
+		suspended, err := strconv.ParseBool(suspendedStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suspended value"})
+			return
+		}
+		if suspended {
+			query += " AND suspended_at IS NOT NULL"
+		} else {
+			query += " AND suspended_at IS NULL"
+		}
+	}
+	if deletedStr := c.Query("deleted"); deletedStr != "" {
+		deleted, err := strconv.ParseBool(deletedStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deleted value"})
+			return
+		}
+		if deleted {
+			query += " AND deleted_at IS NOT NULL"
+		} else {
+			query += " AND deleted_at IS NULL"
+		}
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*)"+query, args...).Scan(&total); err != nil {
+		log.Println("Error counting users:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	query = "SELECT id, email, name, role, email_verified_at, suspended_at, suspension_reason, deleted_at, created_at" + query +
+		" ORDER BY created_at DESC, id DESC LIMIT " + addArg(limit) + " OFFSET " + addArg(offset)
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error retrieving users:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+	defer rows.Close()
+
+	users := []gin.H{}
+	for rows.Next() {
+		var user struct {
+			ID               int
+			Email            string
+			Name             string
+			Role             string
+			EmailVerifiedAt  sql.NullTime
+			SuspendedAt      sql.NullTime
+			SuspensionReason sql.NullString
+			DeletedAt        sql.NullTime
+			CreatedAt        time.Time
+		}
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.EmailVerifiedAt, &user.SuspendedAt, &user.SuspensionReason, &user.DeletedAt, &user.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+			return
+		}
+		users = append(users, gin.H{
+			"id":               strconv.Itoa(user.ID),
+			"email":            user.Email,
+			"name":             user.Name,
+			"role":             user.Role,
+			"emailVerified":    user.EmailVerifiedAt.Valid,
+			"suspendedAt":      formatNullTime(user.SuspendedAt),
+			"suspensionReason": user.SuspensionReason.String,
+			"deletedAt":        formatNullTime(user.DeletedAt),
+			"createdAt":        user.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": users, "meta": gin.H{"limit": limit, "offset": offset, "total": total}})
+}
+
+func AdminUpdateUserRole(c *gin.Context) {
+	adminID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Role string `json:"role" binding:"required,oneof=user moderator admin"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Param("id") == strconv.Itoa(adminID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot change their own role"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// Revoke the sessions of the user so the role claim of their tokens is current
+	result, err := DB.Exec("UPDATE users SET role = $1, token_expired_at = NOW(), updated_at = NOW() WHERE id = $2 AND role != $1", request.Role, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		var exists bool
+		if err := DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", c.Param("id")).Scan(&exists); err != nil || !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated successfully", "data": gin.H{"id": c.Param("id"), "role": request.Role}})
+}
+
+func AdminSuspendUser(c *gin.Context) {
+	adminID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Param("id") == strconv.Itoa(adminID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot suspend themselves"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	result, err := DB.Exec("UPDATE users SET suspended_at = NOW(), suspension_reason = $1, updated_at = NOW() WHERE id = $2 AND suspended_at IS NULL AND deleted_at IS NULL",
+		nullIfEmpty(request.Reason), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend user"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found or already suspended"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended successfully"})
+}
+
+func AdminUnsuspendUser(c *gin.Context) {
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	result, err := DB.Exec("UPDATE users SET suspended_at = NULL, suspension_reason = NULL, updated_at = NOW() WHERE id = $1 AND suspended_at IS NOT NULL", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unsuspend user"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found or not suspended"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unsuspended successfully"})
+}
+
+func AdminGetDeletedCats(c *gin.Context) {
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	rows, err := DB.Query(`SELECT cats.id, cats.name, cats.race, cats.sex, cats.age_in_month, cats.image_urls, cats.user_id, owner.email, cats.deleted_at, cats.created_at
+		FROM cats LEFT JOIN users owner ON owner.id = cats.user_id
+		WHERE cats.deleted_at IS NOT NULL ORDER BY cats.deleted_at DESC, cats.id DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		log.Println("Error retrieving deleted cats:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cats"})
+		return
+	}
+	defer rows.Close()
+
+	cats := []gin.H{}
+	for rows.Next() {
+		var cat struct {
+			ID         int
+			Name       string
+			Race       string
+			Sex        string
+			AgeInMonth int
+			ImageURLs  []string
+			UserID     int
+			OwnerEmail sql.NullString
+			DeletedAt  time.Time
+			CreatedAt  time.Time
+		}
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Race, &cat.Sex, &cat.AgeInMonth, pq.Array(&cat.ImageURLs), &cat.UserID, &cat.OwnerEmail, &cat.DeletedAt, &cat.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cats"})
+			return
+		}
+		cats = append(cats, gin.H{
+			"id":         strconv.Itoa(cat.ID),
+			"name":       cat.Name,
+			"race":       cat.Race,
+			"sex":        cat.Sex,
+			"ageInMonth": cat.AgeInMonth,
+			"imageUrls":  cat.ImageURLs,
+			"ownerId":    strconv.Itoa(cat.UserID),
+			"ownerEmail": cat.OwnerEmail.String,
+			"deletedAt":  cat.DeletedAt.Format(time.RFC3339),
+			"createdAt":  cat.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": cats})
+}
+
+func AdminRestoreCat(c *gin.Context) {
+	moderatorID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	tx, err := beginCatTx(DB, moderatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore cat"})
+		return
+	}
+	defer tx.Rollback()
+
+	// A cat of a deleted account stays deleted until the account is back
+	result, err := tx.Exec(`UPDATE cats SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL
+		AND EXISTS(SELECT 1 FROM users WHERE users.id = cats.user_id AND users.deleted_at IS NULL)`, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore cat"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted cat not found or its owner is deleted"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore cat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cat restored successfully"})
+}
+
+func AdminGetDeletedMatches(c *gin.Context) {
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	rows, err := DB.Query(`SELECT id, issuedId, issuedCatId, receiverId, receiverCatId, message, status, deleted_at, created_at
+		FROM match_cats WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		log.Println("Error retrieving deleted matches:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve matches"})
+		return
+	}
+	defer rows.Close()
+
+	matches := []gin.H{}
+	for rows.Next() {
+		var match struct {
+			ID            int
+			IssuedID      int
+			IssuedCatID   int
+			ReceiverID    int
+			ReceiverCatID int
+			Message       string
+			Status        bool
+			DeletedAt     time.Time
+			CreatedAt     time.Time
+		}
+		if err := rows.Scan(&match.ID, &match.IssuedID, &match.IssuedCatID, &match.ReceiverID, &match.ReceiverCatID, &match.Message, &match.Status, &match.DeletedAt, &match.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve matches"})
+			return
+		}
+		matches = append(matches, gin.H{
+			"id":            strconv.Itoa(match.ID),
+			"issuedId":      strconv.Itoa(match.IssuedID),
+			"issuedCatId":   strconv.Itoa(match.IssuedCatID),
+			"receiverId":    strconv.Itoa(match.ReceiverID),
+			"receiverCatId": strconv.Itoa(match.ReceiverCatID),
+			"message":       match.Message,
+			"approved":      match.Status,
+			"deletedAt":     match.DeletedAt.Format(time.RFC3339),
+			"createdAt":     match.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve matches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": matches})
+}
+
+func AdminRestoreMatch(c *gin.Context) {
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var status bool
+	var issuedCatID, receiverCatID int
+	var deletedAt sql.NullTime
+	err = DB.QueryRow("SELECT status, issuedCatId, receiverCatId, deleted_at FROM match_cats WHERE id = $1", c.Param("id")).Scan(&status, &issuedCatID, &receiverCatID, &deletedAt)
+	if err == sql.ErrNoRows || (err == nil && !deletedAt.Valid) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted match not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only a pending request can be restored, and only while both cats are
+	// still available and not part of another active request
+	if status {
+		c.JSON(http.StatusConflict, gin.H{"error": "Approved or superseded matches cannot be restored"})
+		return
+	}
+	var available bool
+	err = DB.QueryRow(`SELECT COUNT(*) = 2 FROM cats WHERE id IN ($1, $2) AND deleted_at IS NULL AND has_matched = false`, issuedCatID, receiverCatID).Scan(&available)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !available {
+		c.JSON(http.StatusConflict, gin.H{"error": "One of the cats is deleted or already matched"})
+		return
+	}
+	var duplicate bool
+	err = DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM match_cats WHERE id != $1 AND deleted_at IS NULL
+		AND ((issuedCatId = $2 AND receiverCatId = $3) OR (issuedCatId = $3 AND receiverCatId = $2)))`, c.Param("id"), issuedCatID, receiverCatID).Scan(&duplicate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if duplicate {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another request between these cats is active"})
+		return
+	}
+
+	_, err = DB.Exec("UPDATE match_cats SET deleted_at = NULL WHERE id = $1", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore match"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Match restored successfully"})
+}
+
+// AdminPurge runs the retention purge now, as a dry run unless dryRun=false
+func AdminPurge(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "true"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dryRun"})
+		return
+	}
+	if maintenance.DefaultPurger == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Retention purge is not configured"})
+		return
+	}
+
+	report, err := maintenance.DefaultPurger.Run(dryRun)
+	if err != nil {
+		log.Println("Error purging:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": report})
+}
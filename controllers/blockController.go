@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blockedSQL builds the condition matching rows of ownerColumn whose owner
+// blocked, or was blocked by, the user of the userArg placeholder
+func blockedSQL(ownerColumn, userArg string) string {
+	return "EXISTS(SELECT 1 FROM user_blocks WHERE (blocker_id = " + userArg + " AND blocked_id = " + ownerColumn + ") OR (blocker_id = " + ownerColumn + " AND blocked_id = " + userArg + "))"
+}
+
+// isBlocked reports whether either user blocked the other
+func isBlocked(DB *sql.DB, userID, otherUserID int) (bool, error) {
+	var blocked bool
+	err := DB.QueryRow("SELECT "+blockedSQL("$2", "$1"), userID, otherUserID).Scan(&blocked)
+	return blocked, err
+}
+
+func BlockUser(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var blockedID int
+	err = DB.QueryRow("SELECT id FROM users WHERE id = $1 AND deleted_at IS NULL", c.Param("id")).Scan(&blockedID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if blockedID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot block yourself"})
+		return
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO user_blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, blockedID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	// Pending requests between both users are withdrawn, approved matches stay
+	rows, err := tx.Query(`UPDATE match_cats SET deleted_at = NOW() WHERE status = false AND deleted_at IS NULL
+		AND ((issuedId = $1 AND receiverId = $2) OR (issuedId = $2 AND receiverId = $1))
+		RETURNING id, receiverId, issuedCatId, receiverCatId`, userID, blockedID)
+	var withdrawn []struct{ matchID, receiverID int }
+	var catIDs []int
+	if err == nil {
+		for rows.Next() {
+			var match struct{ matchID, receiverID int }
+			var issuedCatID, receiverCatID int
+			if err = rows.Scan(&match.matchID, &match.receiverID, &issuedCatID, &receiverCatID); err != nil {
+				break
+			}
+			withdrawn = append(withdrawn, match)
+			catIDs = append(catIDs, issuedCatID, receiverCatID)
+		}
+		rows.Close()
+		if err == nil {
+			err = rows.Err()
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error blocking user:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to block user"})
+		return
+	}
+
+	// Like DeleteMatch, the receivers see the requests withdrawn
+	for _, match := range withdrawn {
+		notifyUser(DB, match.receiverID, events.MatchWithdrawn, gin.H{"matchId": strconv.Itoa(match.matchID)})
+	}
+	notifyFavoritersIfAvailable(DB, catIDs...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "User blocked successfully", "data": gin.H{"withdrawnMatchCount": len(withdrawn)}})
+}
+
+func UnblockUser(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	result, err := DB.Exec("DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2", userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unblock user"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not blocked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unblocked successfully"})
+}
+
+func GetBlockedUsers(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	rows, err := DB.Query(`SELECT users.id, users.name, user_blocks.created_at FROM user_blocks
+		INNER JOIN users ON users.id = user_blocks.blocked_id
+		WHERE user_blocks.blocker_id = $1 ORDER BY user_blocks.created_at DESC`, userID)
+	if err != nil {
+		log.Println("Error retrieving blocked users:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve blocked users"})
+		return
+	}
+	defer rows.Close()
+
+	blocked := []gin.H{}
+	for rows.Next() {
+		var id int
+		var name string
+		var blockedAt time.Time
+		if err := rows.Scan(&id, &name, &blockedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve blocked users"})
+			return
+		}
+		blocked = append(blocked, gin.H{
+			"id":        strconv.Itoa(id),
+			"name":      name,
+			"blockedAt": blockedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve blocked users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": blocked})
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// resolveBreed returns the canonical breed name for a name or alias, matched
+// case-insensitively. An empty name is returned when the breed is unknown.
+func resolveBreed(DB *sql.DB, race string) (string, error) {
+	var name string
+	err := DB.QueryRow("SELECT name FROM breeds WHERE LOWER(name) = LOWER($1) OR LOWER($1) IN (SELECT LOWER(alias) FROM unnest(aliases) AS alias)", strings.TrimSpace(race)).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+func GetBreeds(c *gin.Context) {
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	rows, err := DB.Query("SELECT id, name, aliases, origin, description, created_at FROM breeds ORDER BY name")
+	if err != nil {
+		log.Println("Error retrieving breeds:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve breeds"})
+		return
+	}
+	defer rows.Close()
+
+	breeds := []gin.H{}
+	for rows.Next() {
+		var breed struct {
+			ID          int
+			Name        string
+			Aliases     []string
+			Origin      sql.NullString
+			Description sql.NullString
+			CreatedAt   time.Time
+		}
+		if err := rows.Scan(&breed.ID, &breed.Name, pq.Array(&breed.Aliases), &breed.Origin, &breed.Description, &breed.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve breeds"})
+			return
+		}
+		if breed.Aliases == nil {
+			breed.Aliases = []string{}
+		}
+
+		breeds = append(breeds, gin.H{
+			"id":          strconv.Itoa(breed.ID),
+			"name":        breed.Name,
+			"aliases":     breed.Aliases,
+			"origin":      breed.Origin.String,
+			"description": breed.Description.String,
+			"createdAt":   breed.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve breeds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": breeds})
+}
+
+// CreateBreed is restricted to admins by the route
+func CreateBreed(c *gin.Context) {
+	var breed struct {
+		Name        string   `json:"name" binding:"required,min=1,max=50"`
+		Aliases     []string `json:"aliases" binding:"omitempty,dive,min=1,max=50"`
+		Origin      string   `json:"origin" binding:"max=100"`
+		Description string   `json:"description" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&breed); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if breed.Aliases == nil {
+		breed.Aliases = []string{}
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// Nama dan alias tidak boleh bentrok dengan breed yang sudah ada
+	for _, name := range append([]string{breed.Name}, breed.Aliases...) {
+		existing, err := resolveBreed(DB, name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if existing != "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "\"" + name + "\" is already used by breed " + existing})
+			return
+		}
+	}
+
+	var breedID int
+	var createdAt time.Time
+	err = DB.QueryRow("INSERT INTO breeds (name, aliases, origin, description) VALUES ($1, $2, $3, $4) RETURNING id, created_at",
+		strings.TrimSpace(breed.Name), pq.Array(breed.Aliases), breed.Origin, breed.Description).Scan(&breedID, &createdAt)
+	if err != nil {
+		log.Println("Error adding breed:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add breed"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        strconv.Itoa(breedID),
+			"createdAt": createdAt.Format(time.RFC3339),
+		},
+	})
+}
@@ -2,18 +2,45 @@ package controllers
 
 import (
 	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"CatsSocial/maintenance"
+	"CatsSocial/webhooks"
+	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/lib/pq"
 )
 
+// checkCatOwner responds with the proper error and returns false when
+// the cat does not exist or is not managed by the user, their own cats and
+// the cats of the organizations they own or manage
+func checkCatOwner(c *gin.Context, DB *sql.DB, catID string, userID int) bool {
+	var managed bool
+	err := DB.QueryRow("SELECT "+catAccessSQL("cats", "$2", managerRoles)+" FROM cats WHERE id = $1 AND deleted_at IS NULL", catID, userID).Scan(&managed)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !managed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to manage this cat"})
+		return false
+	}
+	return true
+}
+
 func CreateCat(c *gin.Context) {
 	// Mendapatkan user ID dari token JWT
 	userID, err := configurations.GetUserFromToken(c)
@@ -23,14 +50,7 @@ func CreateCat(c *gin.Context) {
 	}
 
 	// Validasi input
-	var cat struct {
-		Name        string   `json:"name" binding:"required,min=1,max=30"`
-		Race        string   `json:"race" binding:"required,oneof=Persian 'Maine Coon' Siamese Ragdoll Bengal Sphynx 'British Shorthair' 'Abyssinian' 'Scottish Fold' Birman"`
-		Sex         string   `json:"sex" binding:"required,oneof='male' 'female'"`
-		AgeInMonth  int      `json:"ageInMonth" binding:"required,min=1,max=120082"`
-		Description string   `json:"description" binding:"required,min=1,max=200"`
-		ImageURLs   []string `json:"imageUrls" binding:"required,min=1,dive,url"`
-	}
+	var cat catRequest
 
 	if err := c.ShouldBindJSON(&cat); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -48,10 +68,28 @@ func CreateCat(c *gin.Context) {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	var catID int
-	var createdAt time.Time
-	err = DB.QueryRow("INSERT INTO cats (name, race, sex, age_in_month, description, image_urls, user_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
-		cat.Name, cat.Race, cat.Sex, cat.AgeInMonth, cat.Description, pq.Array(cat.ImageURLs), userID).Scan(&catID, &createdAt)
+	// Validasi ras dan induk kucing
+	reason, err := validateCat(DB, 0, &cat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add cat"})
+		return
+	}
+	defer tx.Rollback()
+
+	catID, createdAt, updatedAt, err := insertCat(tx, userID, cat)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		log.Println("Error adding cat:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add cat"})
@@ -68,11 +106,63 @@ func CreateCat(c *gin.Context) {
 		},
 	}
 
+	c.Header("ETag", catETag(updatedAt))
 	c.JSON(http.StatusCreated, response)
 }
 
+// validateCat resolves the race of the cat against the breed catalog and
+// checks its parents, it returns the reason when the cat is invalid
+func validateCat(DB *sql.DB, catID int, cat *catRequest) (string, error) {
+	breed, err := resolveBreed(DB, cat.Race)
+	if err != nil {
+		return "", err
+	}
+	if breed == "" {
+		return "Invalid race", nil
+	}
+	cat.Race = breed
+
+	return validateParents(DB, catID, cat.SireID, cat.DamID)
+}
+
+// insertCat adds a validated cat, queues it for moderation when its
+// description matches the word filter and enqueues the cat.created webhook
+func insertCat(tx *sql.Tx, userID int, cat catRequest) (int, time.Time, time.Time, error) {
+	var catID int
+	var createdAt, updatedAt time.Time
+	err := tx.QueryRow("INSERT INTO cats (name, race, sex, age_in_month, description, image_urls, user_id, sire_id, dam_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at, updated_at",
+		cat.Name, cat.Race, cat.Sex, cat.AgeInMonth, cat.Description, pq.Array(cat.ImageURLs), userID, nullIfEmpty(cat.SireID), nullIfEmpty(cat.DamID)).Scan(&catID, &createdAt, &updatedAt)
+	if err != nil {
+		return 0, createdAt, updatedAt, err
+	}
+
+	// Descriptions matching the word filter are queued for moderation
+	if words := flaggedWords(cat.Description); len(words) > 0 {
+		if err := flagCat(tx, catID, words); err != nil {
+			return 0, createdAt, updatedAt, err
+		}
+	}
+
+	err = webhooks.Enqueue(tx, webhooks.CatCreated, []int{userID}, gin.H{
+		"id":         strconv.Itoa(catID),
+		"name":       cat.Name,
+		"race":       cat.Race,
+		"sex":        cat.Sex,
+		"ageInMonth": cat.AgeInMonth,
+		"createdAt":  createdAt.Format(time.RFC3339),
+	})
+	return catID, createdAt, updatedAt, err
+}
+
 func GetCats(c *gin.Context) {
-	if err := configurations.CheckBearerToken(c); err != nil {
+	listCats(c, false)
+}
+
+// listCats answers GetCats and GetFavoriteCats, favoritesOnly restricts the
+// results to the cats favorited by the user
+func listCats(c *gin.Context, favoritesOnly bool) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
@@ -90,13 +180,30 @@ func GetCats(c *gin.Context) {
 	ageInMonth := c.Query("ageInMonth")
 	ownedStr := c.Query("owned")
 	search := c.Query("search")
+	near := c.Query("near")
+	radiusKm := c.Query("radiusKm")
 	limit := c.DefaultQuery("limit", "5")
 	offset := c.DefaultQuery("offset", "0")
 	var deletedAt string
 
 	// Construct SQL query based on query parameters
-	query := "SELECT id, name, race, sex, age_in_month, description, image_urls, has_matched, created_at FROM cats WHERE 1=1"
+	query := " FROM cats LEFT JOIN users owner ON owner.id = cats.user_id WHERE 1=1"
 	args := []interface{}{}
+	// addArg appends a query argument and returns its placeholder
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	// Cats hidden by moderators are only visible to their owner, cats of
+	// blocked users are not visible in either direction
+	userArg := addArg(userID)
+	query += " AND (cats.hidden_at IS NULL OR cats.user_id = " + userArg + ")"
+	query += " AND NOT " + blockedSQL("cats.user_id", userArg)
+	isFavorite := "EXISTS(SELECT 1 FROM favorite_cats WHERE favorite_cats.cat_id = cats.id AND favorite_cats.user_id = " + userArg + ")"
+	if favoritesOnly {
+		query += " AND " + isFavorite
+	}
 
 	if id != "" {
 		idInt, err := strconv.Atoi(id)
@@ -104,31 +211,22 @@ func GetCats(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
 			return
 		}
-		query += " AND id = " + strconv.Itoa(idInt)
-		args = append(args)
+		query += " AND cats.id = " + addArg(idInt)
 	}
 
 	if race != "" {
-		// Capitalize the first letter and lowercase the rest of the string
-		race = strings.ToLower(race)
-		race = strings.Title(race)
-
-		// Validate race against allowed values
-		allowedRaces := []string{"Persian", "Maine Coon", "Siamese", "Ragdoll", "Bengal", "Sphynx", "British Shorthair", "Abyssinian", "Scottish Fold", "Birman"}
-		var validRace bool
-		for _, r := range allowedRaces {
-			if race == r {
-				validRace = true
-				break
-			}
+		// Validate race against the breed catalogue, aliases are accepted
+		breed, err := resolveBreed(DB, race)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		if !validRace {
+		if breed == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid race"})
 			return
 		}
 		// Append WHERE clause for race if it's valid
-		query += " AND race = '" + race + "'"
-		args = append(args)
+		query += " AND cats.race = " + addArg(breed)
 	}
 
 	if sex != "" {
@@ -138,20 +236,18 @@ func GetCats(c *gin.Context) {
 			return
 		}
 		// Append WHERE clause for sex if it's valid
-		query += " AND sex = '" + sex + "'"
-		args = append(args)
+		query += " AND cats.sex = " + addArg(sex)
 	}
 
 	if hasMatchedStr != "" {
 		// Parse hasMatched as boolean
-		// hasMatched, err := strconv.ParseBool(hasMatchedStr)
-		// if err != nil {
-		// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hasMatched value"})
-		// 	return
-		// }
+		hasMatched, err := strconv.ParseBool(hasMatchedStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hasMatched value"})
+			return
+		}
 		// Append WHERE clause for hasMatched
-		query += " AND has_matched = " + hasMatchedStr
-		args = append(args)
+		query += " AND cats.has_matched = " + addArg(hasMatched)
 	}
 
 	if ageInMonth != "" {
@@ -161,11 +257,8 @@ func GetCats(c *gin.Context) {
 			ageCondition = ">"
 		} else if strings.HasPrefix(ageInMonth, "<") {
 			ageCondition = "<"
-		} else if strings.HasPrefix(ageInMonth, "") {
-			ageCondition = "="
 		} else {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ageInMonth filter"})
-			return
+			ageCondition = "="
 		}
 
 		ageValue, err := strconv.Atoi(strings.TrimPrefix(ageInMonth, ageCondition))
@@ -175,8 +268,7 @@ func GetCats(c *gin.Context) {
 		}
 
 		// Append WHERE clause for ageInMonth
-		query += " AND age_in_month " + ageCondition + " " + strconv.Itoa(ageValue)
-		args = append(args)
+		query += " AND cats.age_in_month " + ageCondition + " " + addArg(ageValue)
 	}
 
 	if ownedStr != "" {
@@ -189,26 +281,70 @@ func GetCats(c *gin.Context) {
 
 		// If owned is true, filter cats with a non-null user_id
 		if owned {
-			query += " AND deleted_at IS NULL"
+			query += " AND cats.deleted_at IS NULL"
 		} else {
 			// If owned is false, filter cats with a null user_id
-			query += " AND deleted_at IS NOT NULL"
+			query += " AND cats.deleted_at IS NOT NULL"
 		}
 	} else {
-		deletedAt = " AND deleted_at IS NULL"
+		deletedAt = " AND cats.deleted_at IS NULL"
 		query += deletedAt
-		args = append(args)
 	}
 
 	if search != "" {
 		// Append WHERE clause for search
-		query += " AND name LIKE '%" + search + "%'"
-		args = append(args)
+		query += " AND cats.name LIKE " + addArg("%"+search+"%")
 	}
 
+	// Filter and sort by distance to the owner location
+	distance := "NULL::DOUBLE PRECISION"
+	orderBy := "cats.created_at DESC"
+	if near != "" {
+		lat, lon, ok := parseNear(near)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid near, must be lat,lon"})
+			return
+		}
+		distance = haversineSQL(addArg(lat), addArg(lon))
+		query += " AND owner.latitude IS NOT NULL AND owner.longitude IS NOT NULL"
+
+		if radiusKm != "" {
+			radius, err := strconv.ParseFloat(radiusKm, 64)
+			if err != nil || radius <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid radiusKm"})
+				return
+			}
+			// Bounding box first so the location index can be used
+			minLat, maxLat, lonRanges := boundingBox(lat, lon, radius)
+			query += " AND owner.latitude BETWEEN " + addArg(minLat) + " AND " + addArg(maxLat)
+			lonConditions := []string{}
+			for _, lonRange := range lonRanges {
+				lonConditions = append(lonConditions, "owner.longitude BETWEEN "+addArg(lonRange.min)+" AND "+addArg(lonRange.max))
+			}
+			query += " AND (" + strings.Join(lonConditions, " OR ") + ")"
+			query += " AND " + distance + " <= " + addArg(radius)
+		}
+		orderBy = "distance_km ASC, cats.created_at DESC"
+	} else if radiusKm != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "radiusKm requires near"})
+		return
+	}
+	query = "SELECT cats.id, cats.name, cats.race, cats.sex, cats.age_in_month, cats.description, cats.image_urls, cats.has_matched, cats.organization_id, cats.created_at, cats.updated_at, " + isFavorite + " AS is_favorite, " + distance + " AS distance_km" + query
+
 	if limit != "" && offset != "" {
-		query += " ORDER BY created_at DESC LIMIT " + limit + " OFFSET " + offset
-		args = append(args)
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil || limitInt < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		offsetInt, err := strconv.Atoi(offset)
+		if err != nil || offsetInt < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		query += " ORDER BY " + orderBy + " LIMIT " + addArg(limitInt) + " OFFSET " + addArg(offsetInt)
+	} else {
+		query += " ORDER BY " + orderBy
 	}
 	fmt.Println(query)
 
@@ -226,34 +362,48 @@ func GetCats(c *gin.Context) {
 	// Iterate over rows and append to cats slice
 	for rows.Next() {
 		var cat struct {
-			ID          int       `json:"id"`
-			Name        string    `json:"name"`
-			Race        string    `json:"race"`
-			Sex         string    `json:"sex"`
-			AgeInMonth  int       `json:"ageInMonth"`
-			Description string    `json:"description"`
-			ImageURLs   []string  `json:"imageUrls"`
-			HasMatched  bool      `json:"hasMatched"`
-			CreatedAt   time.Time `json:"createdAt"`
+			ID          int           `json:"id"`
+			Name        string        `json:"name"`
+			Race        string        `json:"race"`
+			Sex         string        `json:"sex"`
+			AgeInMonth  int           `json:"ageInMonth"`
+			Description string        `json:"description"`
+			ImageURLs   []string      `json:"imageUrls"`
+			HasMatched  bool          `json:"hasMatched"`
+			OrgID       sql.NullInt64 `json:"organizationId"`
+			CreatedAt   time.Time     `json:"createdAt"`
+			UpdatedAt   time.Time     `json:"updatedAt"`
 		}
+		var isFavorite bool
+		var distanceKm sql.NullFloat64
 
-		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Race, &cat.Sex, &cat.AgeInMonth, &cat.Description, pq.Array(&cat.ImageURLs), &cat.HasMatched, &cat.CreatedAt); err != nil {
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Race, &cat.Sex, &cat.AgeInMonth, &cat.Description, pq.Array(&cat.ImageURLs), &cat.HasMatched, &cat.OrgID, &cat.CreatedAt, &cat.UpdatedAt, &isFavorite, &distanceKm); err != nil {
 			log.Println("Error scanning row:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cats"})
 			return
 		}
 
-		cats = append(cats, gin.H{
-			"id":          strconv.Itoa(cat.ID),
-			"name":        cat.Name,
-			"race":        cat.Race,
-			"sex":         cat.Sex,
-			"ageInMonth":  cat.AgeInMonth,
-			"imageUrls":   cat.ImageURLs,
-			"description": cat.Description,
-			"hasMatched":  cat.HasMatched,
-			"createdAt":   cat.CreatedAt.Format(time.RFC3339),
-		})
+		result := gin.H{
+			"id":             strconv.Itoa(cat.ID),
+			"name":           cat.Name,
+			"race":           cat.Race,
+			"sex":            cat.Sex,
+			"ageInMonth":     cat.AgeInMonth,
+			"imageUrls":      cat.ImageURLs,
+			"description":    cat.Description,
+			"hasMatched":     cat.HasMatched,
+			"isFavorite":     isFavorite,
+			"organizationId": nil,
+			"createdAt":      cat.CreatedAt.Format(time.RFC3339),
+			"etag":           catETag(cat.UpdatedAt),
+		}
+		if cat.OrgID.Valid {
+			result["organizationId"] = strconv.FormatInt(cat.OrgID.Int64, 10)
+		}
+		if distanceKm.Valid {
+			result["distanceKm"] = math.Round(distanceKm.Float64*10) / 10
+		}
+		cats = append(cats, result)
 	}
 
 	// Check for errors during rows iteration
@@ -272,77 +422,258 @@ func GetCats(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-func UpdateCat(c *gin.Context) {
-	userID, err := configurations.GetUserFromToken(c)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-		return
+// catRequest is the body of CreateCat and UpdateCat, and the document the
+// merge patch of PatchCat is applied to
+type catRequest struct {
+	Name        string   `json:"name" binding:"required,min=1,max=30"`
+	Race        string   `json:"race" binding:"required"`
+	Sex         string   `json:"sex" binding:"required,oneof=male female"`
+	AgeInMonth  int      `json:"ageInMonth" binding:"required,min=1,max=120082"`
+	Description string   `json:"description" binding:"required,min=1,max=200"`
+	ImageURLs   []string `json:"imageUrls" binding:"required,min=1,dive,url"`
+	SireID      string   `json:"sireId,omitempty"`
+	DamID       string   `json:"damId,omitempty"`
+}
+
+// catETag derives the entity tag of a cat from its updated_at
+func catETag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMicro(), 10) + `"`
+}
+
+// checkIfMatch answers 412 when the If-Match header names another version of the cat
+func checkIfMatch(c *gin.Context, updatedAt time.Time) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || ifMatch == "*" {
+		return true
 	}
-	DB, err := configurations.DBConnection()
-	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+	etag := catETag(updatedAt)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if strings.TrimSpace(tag) == etag {
+			return true
+		}
 	}
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Cat has been modified, reload it and try again"})
+	return false
+}
 
-	// Get cat ID from path params
-	catID := c.Param("id")
-	var catUserId int
+// checkCatUpdatable refuses cats that are not managed by the user, deleted,
+// matched or involved in matches, and returns the updated_at of the cat
+func checkCatUpdatable(c *gin.Context, DB *sql.DB, catID string, userID int) (time.Time, bool) {
+	var managed bool
 	var catDeletedAt sql.NullTime
 	var catHasMatched bool
-	err = DB.QueryRow("SELECT user_id, deleted_at, has_matched from cats where id=$1", catID).Scan(&catUserId, &catDeletedAt, &catHasMatched)
-	if err != nil {
+	var updatedAt time.Time
+	err := DB.QueryRow("SELECT "+catAccessSQL("cats", "$2", managerRoles)+", deleted_at, has_matched, updated_at from cats where id=$1", catID, userID).Scan(&managed, &catDeletedAt, &catHasMatched, &updatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return updatedAt, false
+	} else if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return updatedAt, false
 	}
-	if catUserId != userID {
+	if !managed {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Not Allowed to Update"})
-		return
+		return updatedAt, false
 	}
 	if catDeletedAt.Valid {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot update a soft deleted cat"})
-		return
+		return updatedAt, false
 	}
 	if catHasMatched {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot Update Cat has matched"})
-		return
+		return updatedAt, false
 	}
 
 	var exists bool
 	err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM match_cats WHERE (issuedCatId=$1 OR receiverCatId=$1) AND deleted_at IS NULL)", catID).Scan(&exists)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+		return updatedAt, false
 	}
 	if exists {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cat cannot be updated because it is involved in matches"})
+		return updatedAt, false
+	}
+	return updatedAt, true
+}
+
+// saveCat validates the race and parents of the cat and writes it, unless
+// the cat changed since updatedAt was read
+func saveCat(c *gin.Context, DB *sql.DB, userID int, catID string, cat catRequest, updatedAt time.Time) {
+	// Validate race and parents, a cat cannot become its own ancestor
+	catIDInt, _ := strconv.Atoi(catID)
+	reason, err := validateCat(DB, catIDInt, &cat)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
 		return
 	}
 
-	// Bind request body to Cat struct
-	var cat struct {
-		Name        string   `json:"name" binding:"required,min=1,max=30"`
-		Race        string   `json:"race" binding:"required,oneof=Persian 'Maine Coon' Siamese Ragdoll Bengal Sphynx 'British Shorthair' Abyssinian 'Scottish Fold' Birman"`
-		Sex         string   `json:"sex" binding:"required,oneof=male female"`
-		AgeInMonth  int      `json:"ageInMonth" binding:"required,min=1,max=120082"`
-		Description string   `json:"description" binding:"required,min=1,max=200"`
-		ImageURLs   []string `json:"imageUrls" binding:"required,min=1,dive,url"`
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cat"})
+		return
 	}
-	fmt.Println(cat)
+	defer tx.Rollback()
 
+	// Update cat data in the database, the updated_at guard refuses stale writes
+	err = tx.QueryRow("UPDATE cats SET name=$1, race=$2, sex=$3, age_in_month=$4, description=$5, image_urls=$6, sire_id=$7, dam_id=$8 WHERE id=$9 AND updated_at=$10 RETURNING updated_at",
+		cat.Name, cat.Race, cat.Sex, cat.AgeInMonth, cat.Description, pq.Array(cat.ImageURLs), nullIfEmpty(cat.SireID), nullIfEmpty(cat.DamID), catID, updatedAt).Scan(&updatedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "Cat has been modified, reload it and try again"})
+		return
+	}
+	if err == nil {
+		err = flagCat(tx, catID, flaggedWords(cat.Description))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error updating cat:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cat"})
+		return
+	}
+
+	c.Header("ETag", catETag(updatedAt))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cat updated successfully",
+		"data": gin.H{
+			"id":          catID,
+			"name":        cat.Name,
+			"race":        cat.Race,
+			"sex":         cat.Sex,
+			"ageInMonth":  cat.AgeInMonth,
+			"description": cat.Description,
+			"imageUrls":   cat.ImageURLs,
+			"sireId":      nullIfEmpty(cat.SireID),
+			"damId":       nullIfEmpty(cat.DamID),
+			"updatedAt":   updatedAt.Format(time.RFC3339),
+		},
+	})
+}
+
+func UpdateCat(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// Get cat ID from path params
+	catID := c.Param("id")
+	updatedAt, ok := checkCatUpdatable(c, DB, catID, userID)
+	if !ok || !checkIfMatch(c, updatedAt) {
+		return
+	}
+
+	// Bind request body to Cat struct
+	var cat catRequest
 	if err := c.ShouldBindJSON(&cat); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Update cat data in the database
-	_, err = DB.Exec("UPDATE cats SET name=$1, race=$2, sex=$3, age_in_month=$4, description=$5, image_urls=$6 WHERE id=$7",
-		cat.Name, cat.Race, cat.Sex, cat.AgeInMonth, cat.Description, pq.Array(cat.ImageURLs), catID)
+	saveCat(c, DB, userID, catID, cat, updatedAt)
+}
+
+// PatchCat applies a JSON Merge Patch (RFC 7396) to the cat, fields set to
+// null are removed and the result is validated like CreateCat
+func PatchCat(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cat"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
+	if contentType := c.ContentType(); contentType != "application/merge-patch+json" && contentType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be application/merge-patch+json"})
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	if err := json.NewDecoder(c.Request.Body).Decode(&patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Patch must be a JSON object"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
 	defer DB.Close()
 
-	c.JSON(http.StatusOK, gin.H{"message": "Cat updated successfully"})
+	catID := c.Param("id")
+	updatedAt, ok := checkCatUpdatable(c, DB, catID, userID)
+	if !ok || !checkIfMatch(c, updatedAt) {
+		return
+	}
+
+	var cat catRequest
+	var sireID, damID sql.NullInt64
+	err = DB.QueryRow("SELECT name, race, sex, age_in_month, description, image_urls, sire_id, dam_id FROM cats WHERE id = $1", catID).
+		Scan(&cat.Name, &cat.Race, &cat.Sex, &cat.AgeInMonth, &cat.Description, pq.Array(&cat.ImageURLs), &sireID, &damID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sireID.Valid {
+		cat.SireID = strconv.FormatInt(sireID.Int64, 10)
+	}
+	if damID.Valid {
+		cat.DamID = strconv.FormatInt(damID.Int64, 10)
+	}
+
+	cat, err = mergeCatPatch(cat, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveCat(c, DB, userID, catID, cat, updatedAt)
+}
+
+// mergeCatPatch merges the patch into the cat and validates the result, the
+// fields of a cat are not objects so every member replaces or removes a
+// whole field
+func mergeCatPatch(cat catRequest, patch map[string]json.RawMessage) (catRequest, error) {
+	document, err := json.Marshal(cat)
+	if err != nil {
+		return catRequest{}, err
+	}
+	merged := map[string]json.RawMessage{}
+	if err := json.Unmarshal(document, &merged); err != nil {
+		return catRequest{}, err
+	}
+	for field, value := range patch {
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			delete(merged, field)
+		} else {
+			merged[field] = value
+		}
+	}
+	document, err = json.Marshal(merged)
+	if err != nil {
+		return catRequest{}, err
+	}
+
+	var result catRequest
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&result); err != nil {
+		return catRequest{}, err
+	}
+	if err := binding.Validator.ValidateStruct(&result); err != nil {
+		return catRequest{}, err
+	}
+	return result, nil
 }
 
 func DeleteCat(c *gin.Context) {
@@ -370,8 +701,8 @@ func DeleteCat(c *gin.Context) {
 		return
 	}
 
-	var catUserID int
-	err = DB.QueryRow("SELECT user_id FROM cats WHERE id=$1", catID).Scan(&catUserID)
+	var managed bool
+	err = DB.QueryRow("SELECT "+catAccessSQL("cats", "$2", managerRoles)+" FROM cats WHERE id=$1", catID, userID).Scan(&managed)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
 		return
@@ -380,18 +711,93 @@ func DeleteCat(c *gin.Context) {
 		return
 	}
 
-	if catUserID != userID {
+	if !managed {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to delete"})
 		return
 	}
 
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cat"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Soft delete: set deleted_at field
-	_, err = DB.Exec("UPDATE cats SET deleted_at = NOW() WHERE id = $1", catID)
+	_, err = tx.Exec("UPDATE cats SET deleted_at = NOW() WHERE id = $1", catID)
+	if err == nil {
+		err = webhooks.Enqueue(tx, webhooks.CatDeleted, []int{userID}, gin.H{"id": catID})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cat"})
 		return
 	}
 	defer DB.Close()
 
+	catIDInt, _ := strconv.Atoi(catID)
+	notifyFavoriters(DB, catIDInt, events.FavoriteDeleted)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Cat deleted successfully"})
 }
+
+func RestoreCat(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	grace := int64(maintenance.RestoreGracePeriod() / time.Second)
+
+	var managed, deleted, withinGrace bool
+	err = DB.QueryRow("SELECT "+catAccessSQL("cats", "$3", managerRoles)+", deleted_at IS NOT NULL, COALESCE(deleted_at > NOW() - $2 * INTERVAL '1 second', false) FROM cats WHERE id = $1",
+		catID, grace, userID).Scan(&managed, &deleted, &withinGrace)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !managed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to restore"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cat is not deleted"})
+		return
+	}
+	if !withinGrace {
+		c.JSON(http.StatusGone, gin.H{"error": "The restore period of this cat has expired"})
+		return
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore cat"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE cats SET deleted_at = NULL WHERE id = $1", catID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error restoring cat:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore cat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cat restored successfully"})
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMergeCatPatch(t *testing.T) {
+	current := catRequest{
+		Name:        "Milo",
+		Race:        "Persian",
+		Sex:         "male",
+		AgeInMonth:  12,
+		Description: "Friendly",
+		ImageURLs:   []string{"https://example.com/milo.jpg"},
+		SireID:      "3",
+		DamID:       "4",
+	}
+	with := func(change func(*catRequest)) catRequest {
+		cat := current
+		cat.ImageURLs = append([]string(nil), current.ImageURLs...)
+		change(&cat)
+		return cat
+	}
+
+	tests := []struct {
+		name  string
+		patch string
+		want  catRequest
+		ok    bool
+	}{
+		{"empty patch", `{}`, current, true},
+		{"replace a field", `{"name": "Leo"}`, with(func(c *catRequest) { c.Name = "Leo" }), true},
+		{"replace several fields", `{"ageInMonth": 24, "sex": "female"}`, with(func(c *catRequest) { c.AgeInMonth = 24; c.Sex = "female" }), true},
+		{"replace an array", `{"imageUrls": ["https://example.com/a.jpg", "https://example.com/b.jpg"]}`, with(func(c *catRequest) {
+			c.ImageURLs = []string{"https://example.com/a.jpg", "https://example.com/b.jpg"}
+		}), true},
+		{"remove an optional field", `{"sireId": null}`, with(func(c *catRequest) { c.SireID = "" }), true},
+		{"remove both parents", `{"sireId": null, "damId": null}`, with(func(c *catRequest) { c.SireID = ""; c.DamID = "" }), true},
+		{"remove a required field", `{"name": null}`, catRequest{}, false},
+		{"unknown field", `{"color": "black"}`, catRequest{}, false},
+		{"wrong type", `{"ageInMonth": "twelve"}`, catRequest{}, false},
+		{"invalid sex", `{"sex": "unknown"}`, catRequest{}, false},
+		{"invalid image url", `{"imageUrls": ["not a url"]}`, catRequest{}, false},
+		{"empty image urls", `{"imageUrls": []}`, catRequest{}, false},
+		{"name too long", `{"name": "abcdefghijklmnopqrstuvwxyzabcde"}`, catRequest{}, false},
+	}
+	for _, tt := range tests {
+		var patch map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.patch), &patch); err != nil {
+			t.Fatal(err)
+		}
+		got, err := mergeCatPatch(current, patch)
+		if tt.ok && err != nil {
+			t.Errorf("%s: mergeCatPatch() error: %v", tt.name, err)
+			continue
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: mergeCatPatch() = %+v, want an error", tt.name, got)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergeCatPatch() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+	if current.Name != "Milo" || current.SireID != "3" {
+		t.Errorf("mergeCatPatch() modified the current cat: %+v", current)
+	}
+}
@@ -0,0 +1,368 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/lib/pq"
+)
+
+const (
+	maxImportRows  = 1000
+	maxImportBytes = 5 << 20
+)
+
+// catColumns are the CSV columns of the export, imports accept the same
+// columns so an export can be imported back
+var catColumns = []string{"id", "name", "race", "sex", "ageInMonth", "description", "imageUrls", "sireId", "damId", "hasMatched", "createdAt"}
+
+// catImportRow is an NDJSON line, the read only fields of the export are ignored
+type catImportRow struct {
+	catRequest
+	ID         string `json:"id"`
+	HasMatched bool   `json:"hasMatched"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// parsedCat is a row of an import, err is set when the row cannot be read
+type parsedCat struct {
+	cat catRequest
+	err string
+}
+
+// parseCatCSV reads a CSV with a header row, image URLs are separated by whitespace
+func parseCatCSV(r io.Reader) ([]parsedCat, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		known := false
+		for _, column := range catColumns {
+			if strings.EqualFold(name, column) {
+				index[column] = i
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+	}
+
+	var rows []parsedCat
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if parseErr, ok := err.(*csv.ParseError); ok && parseErr.Err == csv.ErrFieldCount {
+			rows = append(rows, parsedCat{err: "Wrong number of fields"})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		value := func(column string) string {
+			if i, ok := index[column]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		row := parsedCat{cat: catRequest{
+			Name:        value("name"),
+			Race:        value("race"),
+			Sex:         value("sex"),
+			Description: value("description"),
+			ImageURLs:   strings.Fields(value("imageUrls")),
+			SireID:      value("sireId"),
+			DamID:       value("damId"),
+		}}
+		if age := value("ageInMonth"); age != "" {
+			if row.cat.AgeInMonth, err = strconv.Atoi(age); err != nil {
+				row.err = "Invalid ageInMonth, must be a number"
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseCatNDJSON reads one JSON object per line, blank lines are skipped
+func parseCatNDJSON(r io.Reader) ([]parsedCat, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxImportBytes)
+
+	var rows []parsedCat
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var row catImportRow
+		decoder := json.NewDecoder(strings.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&row); err != nil {
+			rows = append(rows, parsedCat{err: err.Error()})
+			continue
+		}
+		rows = append(rows, parsedCat{cat: row.catRequest})
+	}
+	return rows, scanner.Err()
+}
+
+// ImportCats adds the cats of a CSV or NDJSON body. In the atomic mode, the
+// default, nothing is added unless every row is valid; in the best_effort
+// mode the valid rows are added and the others reported.
+func ImportCats(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", "atomic")
+	if mode != "atomic" && mode != "best_effort" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode, must be atomic or best_effort"})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var rows []parsedCat
+	switch c.ContentType() {
+	case "text/csv":
+		rows, err = parseCatCSV(body)
+	case "application/x-ndjson", "application/ndjson":
+		rows, err = parseCatNDJSON(body)
+	default:
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type must be text/csv or application/x-ndjson"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import file: " + err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file has no cats"})
+		return
+	}
+	if len(rows) > maxImportRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Import file has more than %d cats", maxImportRows)})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import cats"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Every row is validated like CreateCat, and inserted in a savepoint so
+	// a failed row does not abort the transaction of the others
+	results := make([]gin.H, len(rows))
+	created, failed := 0, 0
+	for i, row := range rows {
+		results[i] = gin.H{"row": i + 1, "status": "failed"}
+		reason := row.err
+		if reason == "" {
+			if err := binding.Validator.ValidateStruct(&row.cat); err != nil {
+				reason = err.Error()
+			}
+		}
+		if reason == "" {
+			reason, err = validateCat(DB, 0, &row.cat)
+			if err != nil {
+				log.Println("Error importing cats:", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import cats"})
+				return
+			}
+		}
+		if reason != "" {
+			results[i]["error"] = reason
+			failed++
+			continue
+		}
+
+		if _, err := tx.Exec("SAVEPOINT import_row"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import cats"})
+			return
+		}
+		catID, _, _, err := insertCat(tx, userID, row.cat)
+		if err != nil {
+			log.Println("Error importing cat:", err)
+			if _, err := tx.Exec("ROLLBACK TO SAVEPOINT import_row"); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import cats"})
+				return
+			}
+			results[i]["error"] = "Failed to add cat"
+			failed++
+			continue
+		}
+		if _, err := tx.Exec("RELEASE SAVEPOINT import_row"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import cats"})
+			return
+		}
+		results[i]["status"] = "created"
+		results[i]["id"] = strconv.Itoa(catID)
+		created++
+	}
+
+	if mode == "atomic" && failed > 0 {
+		for _, result := range results {
+			if result["status"] == "created" {
+				result["status"] = "skipped"
+				delete(result, "id")
+			}
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Import rejected, no cats were added",
+			"data":  gin.H{"mode": mode, "created": 0, "failed": failed, "rows": results},
+		})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error importing cats:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import cats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    gin.H{"mode": mode, "created": created, "failed": failed, "rows": results},
+	})
+}
+
+// ExportCats streams the cats of the user as CSV, the default, or NDJSON
+func ExportCats(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, must be csv or ndjson"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	rows, err := DB.Query("SELECT id, name, race, sex, age_in_month, description, image_urls, sire_id, dam_id, has_matched, created_at FROM cats WHERE user_id = $1 AND deleted_at IS NULL ORDER BY id", userID)
+	if err != nil {
+		log.Println("Error exporting cats:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export cats"})
+		return
+	}
+	defer rows.Close()
+
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Header("Content-Disposition", `attachment; filename="cats.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	csvWriter := csv.NewWriter(c.Writer)
+	encoder := json.NewEncoder(c.Writer)
+	if format == "csv" {
+		csvWriter.Write(catColumns)
+	}
+
+	// The response is already started, errors past this point can only be logged
+	count := 0
+	for rows.Next() {
+		var cat struct {
+			ID          int
+			Name        string
+			Race        string
+			Sex         string
+			AgeInMonth  int
+			Description string
+			ImageURLs   []string
+			SireID      sql.NullInt64
+			DamID       sql.NullInt64
+			HasMatched  bool
+			CreatedAt   time.Time
+		}
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Race, &cat.Sex, &cat.AgeInMonth, &cat.Description, pq.Array(&cat.ImageURLs),
+			&cat.SireID, &cat.DamID, &cat.HasMatched, &cat.CreatedAt); err != nil {
+			log.Println("Error exporting cats:", err)
+			return
+		}
+
+		sireID, damID := "", ""
+		if cat.SireID.Valid {
+			sireID = strconv.FormatInt(cat.SireID.Int64, 10)
+		}
+		if cat.DamID.Valid {
+			damID = strconv.FormatInt(cat.DamID.Int64, 10)
+		}
+
+		if format == "csv" {
+			err = csvWriter.Write([]string{strconv.Itoa(cat.ID), cat.Name, cat.Race, cat.Sex, strconv.Itoa(cat.AgeInMonth), cat.Description,
+				strings.Join(cat.ImageURLs, " "), sireID, damID, strconv.FormatBool(cat.HasMatched), cat.CreatedAt.Format(time.RFC3339)})
+		} else {
+			if cat.ImageURLs == nil {
+				cat.ImageURLs = []string{}
+			}
+			err = encoder.Encode(gin.H{
+				"id":          strconv.Itoa(cat.ID),
+				"name":        cat.Name,
+				"race":        cat.Race,
+				"sex":         cat.Sex,
+				"ageInMonth":  cat.AgeInMonth,
+				"description": cat.Description,
+				"imageUrls":   cat.ImageURLs,
+				"sireId":      nullIfEmpty(sireID),
+				"damId":       nullIfEmpty(damID),
+				"hasMatched":  cat.HasMatched,
+				"createdAt":   cat.CreatedAt.Format(time.RFC3339),
+			})
+		}
+		if err != nil {
+			log.Println("Error exporting cats:", err)
+			return
+		}
+
+		count++
+		if count%100 == 0 {
+			csvWriter.Flush()
+			c.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error exporting cats:", err)
+	}
+	csvWriter.Flush()
+}
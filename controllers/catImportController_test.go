@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCatCSV(t *testing.T) {
+	milo := catRequest{
+		Name:        "Milo",
+		Race:        "Persian",
+		Sex:         "male",
+		AgeInMonth:  12,
+		Description: "Friendly",
+		ImageURLs:   []string{"https://example.com/a.jpg", "https://example.com/b.jpg"},
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  []parsedCat
+		ok    bool
+	}{
+		{"empty", "", nil, true},
+		{"header only", "name,race,sex,ageInMonth,description,imageUrls\n", nil, true},
+		{
+			"one row",
+			"name,race,sex,ageInMonth,description,imageUrls\nMilo,Persian,male,12,Friendly,https://example.com/a.jpg https://example.com/b.jpg\n",
+			[]parsedCat{{cat: milo}}, true,
+		},
+		{
+			"columns in any order and case with spaces",
+			" ImageUrls ,SEX,name,race,description,ageInMonth\n https://example.com/a.jpg  https://example.com/b.jpg ,male, Milo ,Persian,Friendly, 12 \n",
+			[]parsedCat{{cat: milo}}, true,
+		},
+		{
+			"export columns are accepted",
+			"id,name,race,sex,ageInMonth,description,imageUrls,sireId,damId,hasMatched,createdAt\n9,Milo,Persian,male,12,Friendly,https://example.com/a.jpg,3,4,true,2024-01-01T00:00:00Z\n",
+			[]parsedCat{{cat: catRequest{Name: "Milo", Race: "Persian", Sex: "male", AgeInMonth: 12, Description: "Friendly", ImageURLs: []string{"https://example.com/a.jpg"}, SireID: "3", DamID: "4"}}}, true,
+		},
+		{
+			"quoted description",
+			"name,description\nMilo,\"Likes fish, naps\"\n",
+			[]parsedCat{{cat: catRequest{Name: "Milo", Description: "Likes fish, naps", ImageURLs: []string{}}}}, true,
+		},
+		{
+			"invalid age",
+			"name,ageInMonth\nMilo,twelve\n",
+			[]parsedCat{{cat: catRequest{Name: "Milo", ImageURLs: []string{}}, err: "Invalid ageInMonth, must be a number"}}, true,
+		},
+		{
+			"wrong number of fields",
+			"name,race\nMilo\nLuna,Siamese\n",
+			[]parsedCat{{err: "Wrong number of fields"}, {cat: catRequest{Name: "Luna", Race: "Siamese", ImageURLs: []string{}}}}, true,
+		},
+		{"unknown column", "name,color\nMilo,black\n", nil, false},
+		{"malformed quotes", "name,race\n\"Milo,Persian\n", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseCatCSV(strings.NewReader(tt.input))
+		if tt.ok != (err == nil) {
+			t.Errorf("%s: parseCatCSV() error = %v, want ok %t", tt.name, err, tt.ok)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseCatCSV() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseCatNDJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		cats   []catRequest
+		errors []bool
+	}{
+		{"empty", "", nil, nil},
+		{"blank lines", "\n  \n\n", nil, nil},
+		{
+			"two rows",
+			`{"name":"Milo","sex":"male","ageInMonth":12,"imageUrls":["https://example.com/a.jpg"]}` + "\n\n" + `{"name":"Luna","damId":"4"}` + "\n",
+			[]catRequest{{Name: "Milo", Sex: "male", AgeInMonth: 12, ImageURLs: []string{"https://example.com/a.jpg"}}, {Name: "Luna", DamID: "4"}},
+			[]bool{false, false},
+		},
+		{
+			"export fields are ignored",
+			`{"id":"9","name":"Milo","hasMatched":true,"createdAt":"2024-01-01T00:00:00Z"}`,
+			[]catRequest{{Name: "Milo"}},
+			[]bool{false},
+		},
+		{
+			"invalid rows are reported",
+			`{"name":"Milo","color":"black"}` + "\n" + `{"name":` + "\n" + `{"ageInMonth":"twelve"}` + "\n" + `{"name":"Luna"}`,
+			[]catRequest{{}, {}, {}, {Name: "Luna"}},
+			[]bool{true, true, true, false},
+		},
+	}
+	for _, tt := range tests {
+		got, err := parseCatNDJSON(strings.NewReader(tt.input))
+		if err != nil {
+			t.Errorf("%s: parseCatNDJSON() error: %v", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.cats) {
+			t.Errorf("%s: parseCatNDJSON() = %+v, want %d rows", tt.name, got, len(tt.cats))
+			continue
+		}
+		for i, row := range got {
+			if (row.err != "") != tt.errors[i] {
+				t.Errorf("%s: row %d error = %q, want error %t", tt.name, i, row.err, tt.errors[i])
+			}
+			if !tt.errors[i] && !reflect.DeepEqual(row.cat, tt.cats[i]) {
+				t.Errorf("%s: row %d = %+v, want %+v", tt.name, i, row.cat, tt.cats[i])
+			}
+		}
+	}
+}
+
+func TestParseCatNDJSONLongLine(t *testing.T) {
+	line := `{"name":"Milo","description":"` + strings.Repeat("a", 100*1024) + `"}`
+	rows, err := parseCatNDJSON(strings.NewReader(line))
+	if err != nil || len(rows) != 1 || rows[0].err != "" {
+		t.Fatalf("parseCatNDJSON() of a 100 KiB line = %d rows, %v", len(rows), err)
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// beginCatTx starts a transaction whose changes to cats are recorded in
+// cat_revisions with actorID as their author
+func beginCatTx(DB *sql.DB, actorID int) (*sql.Tx, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("SELECT set_config('app.actor_id', $1, true)", strconv.Itoa(actorID)); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+func GetCatHistory(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// The history of deleted cats stays available to their owner and to the
+	// members of their organization
+	catID := c.Param("id")
+	var member bool
+	err = DB.QueryRow("SELECT "+catAccessSQL("cats", "$2", memberRoles)+" FROM cats WHERE id = $1", catID, userID).Scan(&member)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !member && !configurations.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to view the history of this cat"})
+		return
+	}
+
+	rows, err := DB.Query("SELECT id, actor_id, action, changes, created_at FROM cat_revisions WHERE cat_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3",
+		catID, limit, offset)
+	if err != nil {
+		log.Println("Error retrieving cat history:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cat history"})
+		return
+	}
+	defer rows.Close()
+
+	revisions := []gin.H{}
+	for rows.Next() {
+		var revision struct {
+			ID        int
+			ActorID   sql.NullInt64
+			Action    string
+			Changes   []byte
+			CreatedAt time.Time
+		}
+		if err := rows.Scan(&revision.ID, &revision.ActorID, &revision.Action, &revision.Changes, &revision.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cat history"})
+			return
+		}
+
+		// Revisions without an actor were made by the system
+		var actorID interface{}
+		if revision.ActorID.Valid {
+			actorID = strconv.FormatInt(revision.ActorID.Int64, 10)
+		}
+		revisions = append(revisions, gin.H{
+			"id":        strconv.Itoa(revision.ID),
+			"actorId":   actorID,
+			"action":    revision.Action,
+			"changes":   json.RawMessage(revision.Changes),
+			"createdAt": revision.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cat history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": revisions})
+}
@@ -0,0 +1,190 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	eventKeepAlive = 30 * time.Second
+	// Stream tokens are only used to open a connection, EventSource and
+	// WebSocket clients request a new one before reconnecting
+	eventStreamPurpose  = "event_stream"
+	eventStreamTokenTTL = time.Minute
+)
+
+// CreateEventStreamToken returns a short-lived token to open an event stream.
+// EventSource and WebSocket clients in browsers cannot set headers, so the
+// token is passed in the query string where it may be logged, unlike the
+// access token.
+func CreateEventStreamToken(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	jti, err := generateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	token, err := configurations.GeneratePurposeToken(userID, eventStreamPurpose, jti, eventStreamTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{"token": token, "expiresIn": int(eventStreamTokenTTL.Seconds())}})
+}
+
+// authenticateStream accepts the access token in the Authorization header or
+// a stream token from CreateEventStreamToken in the query string. It returns
+// the time the session of the stream is checked against, see checkStream.
+func authenticateStream(c *gin.Context) (int, time.Time, error) {
+	if c.GetHeader("Authorization") == "" && c.Query("token") != "" {
+		userID, issuedAt, err := configurations.ParsePurposeTokenIssuedAt(c.Query("token"), eventStreamPurpose)
+		if err == nil {
+			err = configurations.CheckSession(userID, issuedAt)
+		}
+		return userID, issuedAt, err
+	}
+	userID, err := configurations.GetUserFromToken(c)
+	return userID, time.Now(), err
+}
+
+// checkStream reports whether an open stream may go on, streams end when
+// the user is suspended or their sessions are revoked, like after a password
+// reset or the deletion of the account. It runs on every keepalive.
+func checkStream(userID int, since time.Time) bool {
+	return configurations.CheckSession(userID, since) == nil
+}
+
+// allowedOrigin reports whether pages from the origin may open a WebSocket.
+// ALLOWED_ORIGINS lists them separated by commas, by default only the origin
+// of APP_URL is allowed.
+func allowedOrigin(origin string) bool {
+	allowed := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	if os.Getenv("ALLOWED_ORIGINS") == "" {
+		app, err := url.Parse(appURL("/", nil))
+		if err != nil {
+			return false
+		}
+		allowed = []string{app.Scheme + "://" + app.Host}
+	}
+	for _, value := range allowed {
+		if strings.EqualFold(strings.TrimRight(strings.TrimSpace(value), "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// StreamEvents pushes the events of the user as server-sent events
+func StreamEvents(c *gin.Context) {
+	userID, since, err := authenticateStream(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	ch := events.DefaultHub.Subscribe(userID)
+	defer events.DefaultHub.Unsubscribe(userID, ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-ch:
+			c.SSEvent(event.Type, event)
+			return true
+		case <-ticker.C:
+			if !checkStream(userID, since) {
+				return false
+			}
+			// Comment line keeps proxies from closing an idle connection
+			_, err := w.Write([]byte(": keepalive\n\n"))
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// EventsWebSocket pushes the events of the user as JSON WebSocket messages
+func EventsWebSocket(c *gin.Context) {
+	userID, since, err := authenticateStream(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	server := websocket.Server{
+		// Browsers always send their Origin, other clients may leave it out
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return nil
+			}
+			if !allowedOrigin(origin) {
+				return fmt.Errorf("origin %q is not allowed", origin)
+			}
+			var err error
+			config.Origin, err = websocket.Origin(config, r)
+			return err
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			ch := events.DefaultHub.Subscribe(userID)
+			defer events.DefaultHub.Unsubscribe(userID, ch)
+
+			// Incoming messages are ignored, reading only detects the client closing
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				var message string
+				for websocket.Message.Receive(ws, &message) == nil {
+				}
+			}()
+
+			ticker := time.NewTicker(eventKeepAlive)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case event := <-ch:
+					if err := websocket.JSON.Send(ws, event); err != nil {
+						return
+					}
+				case <-ticker.C:
+					if !checkStream(userID, since) {
+						return
+					}
+					if err := websocket.JSON.Send(ws, gin.H{"type": "ping"}); err != nil {
+						return
+					}
+				case <-closed:
+					return
+				}
+			}
+		},
+	}
+	server.ServeHTTP(c.Writer, c.Request)
+}
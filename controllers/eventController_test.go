@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAllowedOrigin(t *testing.T) {
+	tests := []struct {
+		allowedOrigins string
+		appURL         string
+		origin         string
+		allowed        bool
+	}{
+		{"", "", "http://localhost:8080", true},
+		{"", "https://cats.example.com/app/", "https://cats.example.com", true},
+		{"", "https://cats.example.com", "https://evil.example.com", false},
+		{"https://a.example.com, https://b.example.com/", "", "https://b.example.com", true},
+		{"https://a.example.com", "", "http://localhost:8080", false},
+		{"https://a.example.com", "", "null", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("ALLOWED_ORIGINS", tt.allowedOrigins)
+		t.Setenv("APP_URL", tt.appURL)
+		if got := allowedOrigin(tt.origin); got != tt.allowed {
+			t.Errorf("allowedOrigin(%q) with ALLOWED_ORIGINS=%q APP_URL=%q = %t, want %t", tt.origin, tt.allowedOrigins, tt.appURL, got, tt.allowed)
+		}
+	}
+}
+
+func TestAuthenticateStreamQueryToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	configurations.JWTSecret = "test-secret"
+	defer func() { configurations.JWTSecret = "" }()
+
+	streamToken, err := configurations.GeneratePurposeToken(7, eventStreamPurpose, "jti", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := configurations.GenerateToken("budi@example.com", 7, configurations.RoleUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"stream token", streamToken, true},
+		{"access token", accessToken, false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1/events?token="+tt.token, nil)
+		userID, since, err := authenticateStream(c)
+		if tt.valid && (err != nil || userID != 7 || time.Since(since) > time.Minute) {
+			t.Errorf("%s: authenticateStream() = %d, %v, %v, want 7 issued just now", tt.name, userID, since, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("%s: authenticateStream() accepted the token", tt.name)
+		}
+	}
+}
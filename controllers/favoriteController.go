@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scanCatIDs reads every integer column of the rows, like the cat IDs
+// returned by an UPDATE ... RETURNING
+func scanCatIDs(rows *sql.Rows, err error) ([]int, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var catIDs []int
+	for rows.Next() {
+		ids := make([]int, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range ids {
+			dest[i] = &ids[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		catIDs = append(catIDs, ids...)
+	}
+	return catIDs, rows.Err()
+}
+
+// notifyFavoriters notifies every user who favorited the cat, except its owner
+func notifyFavoriters(DB *sql.DB, catID int, eventType string) {
+	var catName string
+	var ownerID int
+	err := DB.QueryRow("SELECT name, user_id FROM cats WHERE id = $1", catID).Scan(&catName, &ownerID)
+	if err != nil {
+		log.Println("Error retrieving favorited cat:", err)
+		return
+	}
+
+	rows, err := DB.Query("SELECT user_id FROM favorite_cats WHERE cat_id = $1 AND user_id != $2", catID, ownerID)
+	if err != nil {
+		log.Println("Error retrieving favoriters:", err)
+		return
+	}
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			log.Println("Error scanning row:", err)
+			rows.Close()
+			return
+		}
+		userIDs = append(userIDs, userID)
+	}
+	rows.Close()
+
+	for _, userID := range userIDs {
+		notifyUser(DB, userID, eventType, gin.H{"catId": strconv.Itoa(catID), "catName": catName})
+	}
+}
+
+// notifyFavoritersIfAvailable notifies the favoriters of the cats that are
+// available again, not matched and without any pending request
+func notifyFavoritersIfAvailable(DB *sql.DB, catIDs ...int) {
+	for _, catID := range catIDs {
+		var available bool
+		err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM cats WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL AND has_matched = false)
+			AND NOT EXISTS(SELECT 1 FROM match_cats WHERE (issuedCatId = $1 OR receiverCatId = $1) AND deleted_at IS NULL)`, catID).Scan(&available)
+		if err != nil {
+			log.Println("Error checking cat availability:", err)
+			continue
+		}
+		if available {
+			notifyFavoriters(DB, catID, events.FavoriteAvailable)
+		}
+	}
+}
+
+// GetFavoriteCats accepts the same filters and pagination as GetCats
+func GetFavoriteCats(c *gin.Context) {
+	listCats(c, true)
+}
+
+func AddFavoriteCat(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// Only cats visible in GetCats can be favorited
+	var catID, ownerID int
+	err = DB.QueryRow("SELECT id, user_id FROM cats WHERE id = $1 AND deleted_at IS NULL AND hidden_at IS NULL AND NOT "+blockedSQL("user_id", "$2"),
+		c.Param("id"), userID).Scan(&catID, &ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if ownerID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot favorite your own cat"})
+		return
+	}
+
+	_, err = DB.Exec("INSERT INTO favorite_cats (user_id, cat_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to favorite cat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cat added to favorites"})
+}
+
+func RemoveFavoriteCat(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	result, err := DB.Exec("DELETE FROM favorite_cats WHERE user_id = $1 AND cat_id = $2", userID, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove favorite"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat is not in favorites"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cat removed from favorites"})
+}
@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/maintenance"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type healthRecordRequest struct {
+	RecordType    string `json:"recordType" binding:"required,oneof=vaccination deworming vet_check"`
+	Name          string `json:"name" binding:"required,min=1,max=100"`
+	PerformedAt   string `json:"performedAt" binding:"required,datetime=2006-01-02"`
+	ValidUntil    string `json:"validUntil" binding:"omitempty,datetime=2006-01-02"`
+	Notes         string `json:"notes" binding:"max=500"`
+	AttachmentURL string `json:"attachmentUrl" binding:"omitempty,url"`
+}
+
+// vaccinationRequiredOnApprove reports whether ApproveMatch must check that
+// both cats have an up-to-date vaccination record
+func vaccinationRequiredOnApprove() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_VACCINATION_ON_APPROVE"))
+	return required
+}
+
+// hasValidVaccination checks for a vaccination that has not expired yet. A
+// vaccination without validUntil is considered valid for one year.
+func hasValidVaccination(DB *sql.DB, catID int) (bool, error) {
+	var valid bool
+	err := DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM health_records WHERE cat_id = $1 AND record_type = 'vaccination' AND deleted_at IS NULL
+		AND (valid_until >= CURRENT_DATE OR (valid_until IS NULL AND performed_at >= CURRENT_DATE - INTERVAL '1 year')))`, catID).Scan(&valid)
+	return valid, err
+}
+
+func bindHealthRecord(c *gin.Context) (healthRecordRequest, bool) {
+	var record healthRecordRequest
+	if err := c.ShouldBindJSON(&record); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return record, false
+	}
+	if record.ValidUntil != "" && record.ValidUntil < record.PerformedAt {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "validUntil cannot be before performedAt"})
+		return record, false
+	}
+	return record, true
+}
+
+func CreateHealthRecord(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	record, ok := bindHealthRecord(c)
+	if !ok {
+		return
+	}
+
+	var recordID int
+	var createdAt time.Time
+	err = DB.QueryRow("INSERT INTO health_records (cat_id, record_type, name, performed_at, valid_until, notes, attachment_url) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at",
+		catID, record.RecordType, record.Name, record.PerformedAt, nullIfEmpty(record.ValidUntil), record.Notes, nullIfEmpty(record.AttachmentURL)).Scan(&recordID, &createdAt)
+	if err != nil {
+		log.Println("Error adding health record:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add health record"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        strconv.Itoa(recordID),
+			"createdAt": createdAt.Format(time.RFC3339),
+		},
+	})
+}
+
+func GetHealthRecords(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	var member bool
+	var visibility string
+	err = DB.QueryRow("SELECT "+catAccessSQL("cats", "$2", memberRoles)+", health_visibility FROM cats WHERE id = $1 AND deleted_at IS NULL", catID, userID).Scan(&member, &visibility)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Selain pemilik, hanya pasangan match yang boleh melihat jika diizinkan
+	if !member {
+		var isPartner bool
+		if visibility == "match_partners" {
+			err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM match_cats WHERE (issuedCatId = $1 OR receiverCatId = $1) AND (issuedId = $2 OR receiverId = $2) AND deleted_at IS NULL)", catID, userID).Scan(&isPartner)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if !isPartner {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to view health records of this cat"})
+			return
+		}
+	}
+
+	query := "SELECT id, record_type, name, performed_at, valid_until, notes, attachment_url, created_at FROM health_records WHERE cat_id = $1 AND deleted_at IS NULL"
+	args := []interface{}{catID}
+	if recordType := c.Query("recordType"); recordType != "" {
+		if recordType != "vaccination" && recordType != "deworming" && recordType != "vet_check" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recordType"})
+			return
+		}
+		query += " AND record_type = $2"
+		args = append(args, recordType)
+	}
+	query += " ORDER BY performed_at DESC"
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		log.Println("Error retrieving health records:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve health records"})
+		return
+	}
+	defer rows.Close()
+
+	records := []gin.H{}
+	for rows.Next() {
+		var record struct {
+			ID            int
+			RecordType    string
+			Name          string
+			PerformedAt   time.Time
+			ValidUntil    sql.NullTime
+			Notes         sql.NullString
+			AttachmentURL sql.NullString
+			CreatedAt     time.Time
+		}
+		if err := rows.Scan(&record.ID, &record.RecordType, &record.Name, &record.PerformedAt, &record.ValidUntil, &record.Notes, &record.AttachmentURL, &record.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve health records"})
+			return
+		}
+
+		var validUntil interface{}
+		if record.ValidUntil.Valid {
+			validUntil = record.ValidUntil.Time.Format(time.DateOnly)
+		}
+		var attachmentURL interface{}
+		if record.AttachmentURL.Valid {
+			attachmentURL = record.AttachmentURL.String
+		}
+		records = append(records, gin.H{
+			"id":            strconv.Itoa(record.ID),
+			"recordType":    record.RecordType,
+			"name":          record.Name,
+			"performedAt":   record.PerformedAt.Format(time.DateOnly),
+			"validUntil":    validUntil,
+			"notes":         record.Notes.String,
+			"attachmentUrl": attachmentURL,
+			"createdAt":     record.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve health records"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": records})
+}
+
+func UpdateHealthRecord(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	record, ok := bindHealthRecord(c)
+	if !ok {
+		return
+	}
+
+	result, err := DB.Exec("UPDATE health_records SET record_type = $1, name = $2, performed_at = $3, valid_until = $4, notes = $5, attachment_url = $6, updated_at = NOW() WHERE id = $7 AND cat_id = $8 AND deleted_at IS NULL",
+		record.RecordType, record.Name, record.PerformedAt, nullIfEmpty(record.ValidUntil), record.Notes, nullIfEmpty(record.AttachmentURL), c.Param("recordId"), catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update health record"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Health record not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Health record updated successfully"})
+}
+
+// attachmentTypes are the accepted health record attachments, scans and PDFs
+var attachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// UploadHealthAttachment stores the multipart attachment file of a health
+// record in the image storage, replacing the previous attachment
+func UploadHealthAttachment(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	var exists bool
+	err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM health_records WHERE id = $1 AND cat_id = $2 AND deleted_at IS NULL)", c.Param("recordId"), catID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Health record not found"})
+		return
+	}
+
+	attachmentURL, ok := saveUpload(c, "attachment", "health", attachmentTypes)
+	if !ok {
+		return
+	}
+
+	var previousURL sql.NullString
+	err = DB.QueryRow(`UPDATE health_records SET attachment_url = $1, updated_at = NOW()
+		FROM (SELECT id, attachment_url FROM health_records WHERE id = $2 AND cat_id = $3 AND deleted_at IS NULL FOR UPDATE) old
+		WHERE health_records.id = old.id
+		RETURNING old.attachment_url`, attachmentURL, c.Param("recordId"), catID).Scan(&previousURL)
+	if err != nil {
+		maintenance.ImageStoreFromEnv().Delete(attachmentURL)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Health record not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update health record"})
+		return
+	}
+	if previousURL.Valid {
+		if err := maintenance.DeleteUnreferenced(DB, maintenance.ImageStoreFromEnv(), []string{previousURL.String}); err != nil {
+			log.Println("Error deleting previous attachment:", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{"attachmentUrl": attachmentURL}})
+}
+
+func DeleteHealthRecord(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	// Soft delete: set deleted_at field
+	result, err := DB.Exec("UPDATE health_records SET deleted_at = NOW() WHERE id = $1 AND cat_id = $2 AND deleted_at IS NULL", c.Param("recordId"), catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete health record"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Health record not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Health record deleted successfully"})
+}
+
+func UpdateHealthVisibility(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	var visibility struct {
+		Visibility string `json:"visibility" binding:"required,oneof=private match_partners"`
+	}
+	if err := c.ShouldBindJSON(&visibility); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update health visibility"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE cats SET health_visibility = $1 WHERE id = $2", visibility.Visibility, catID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update health visibility"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Health visibility updated successfully"})
+}
@@ -0,0 +1,218 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const earthRadiusKm = 6371.0
+
+// haversineKm returns the great-circle distance between two coordinates
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLon := (lon2 - lon1) * math.Pi / 180
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Pow(math.Sin(dLon/2), 2)
+	// Rounding can push a slightly above 1 for antipodal points
+	return earthRadiusKm * 2 * math.Asin(math.Sqrt(math.Min(1, a)))
+}
+
+// haversineSQL builds the same computation for the owner location in SQL,
+// latArg and lonArg are the placeholders of the reference point
+func haversineSQL(latArg, lonArg string) string {
+	latArg += "::DOUBLE PRECISION"
+	lonArg += "::DOUBLE PRECISION"
+	return "(" + strconv.FormatFloat(earthRadiusKm, 'f', 0, 64) + " * 2 * ASIN(SQRT(LEAST(1, POWER(SIN(RADIANS(owner.latitude - " + latArg + ") / 2), 2) + " +
+		"COS(RADIANS(" + latArg + ")) * COS(RADIANS(owner.latitude)) * POWER(SIN(RADIANS(owner.longitude - " + lonArg + ") / 2), 2)))))"
+}
+
+// lonRange is an inclusive range of longitudes
+type lonRange struct {
+	min, max float64
+}
+
+// boundingBox returns the latitude range and the longitude ranges covering
+// radiusKm around a point so the users location index can be used before
+// haversine. The longitudes are split in two ranges when the box crosses the
+// antimeridian, and cover every longitude when it contains a pole.
+func boundingBox(lat, lon, radiusKm float64) (float64, float64, []lonRange) {
+	latDelta := radiusKm / 111.045
+	minLat, maxLat := math.Max(lat-latDelta, -90), math.Min(lat+latDelta, 90)
+	if minLat == -90 || maxLat == 90 {
+		return minLat, maxLat, []lonRange{{-180, 180}}
+	}
+
+	lonDelta := radiusKm / (111.045 * math.Cos(lat*math.Pi/180))
+	minLon, maxLon := lon-lonDelta, lon+lonDelta
+	switch {
+	case lonDelta >= 180:
+		return minLat, maxLat, []lonRange{{-180, 180}}
+	case minLon < -180:
+		return minLat, maxLat, []lonRange{{minLon + 360, 180}, {-180, maxLon}}
+	case maxLon > 180:
+		return minLat, maxLat, []lonRange{{minLon, 180}, {-180, maxLon - 360}}
+	}
+	return minLat, maxLat, []lonRange{{minLon, maxLon}}
+}
+
+// reducePrecision rounds a coordinate to two decimals (about 1 km) so the
+// exact address of an owner is never stored
+func reducePrecision(coordinate float64) float64 {
+	return math.Round(coordinate*100) / 100
+}
+
+// parseNear parses the near query parameter in the form of "lat,lon"
+func parseNear(near string) (float64, float64, bool) {
+	parts := strings.Split(near, ",")
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// getUserLocation returns the stored location of a user, ok is false when the
+// user has not set one
+func getUserLocation(DB *sql.DB, userID int) (float64, float64, bool, error) {
+	var lat, lon sql.NullFloat64
+	err := DB.QueryRow("SELECT latitude, longitude FROM users WHERE id = $1", userID).Scan(&lat, &lon)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return lat.Float64, lon.Float64, lat.Valid && lon.Valid, nil
+}
+
+func GetLocation(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var city sql.NullString
+	var lat, lon sql.NullFloat64
+	err = DB.QueryRow("SELECT city, latitude, longitude FROM users WHERE id = $1", userID).Scan(&city, &lat, &lon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve location"})
+		return
+	}
+	if !lat.Valid || !lon.Valid {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not set"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"city":      city.String,
+			"latitude":  lat.Float64,
+			"longitude": lon.Float64,
+		},
+	})
+}
+
+func UpdateLocation(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var location struct {
+		City      string   `json:"city" binding:"max=100"`
+		Latitude  *float64 `json:"latitude" binding:"omitempty,min=-90,max=90"`
+		Longitude *float64 `json:"longitude" binding:"omitempty,min=-180,max=180"`
+	}
+	if err := c.ShouldBindJSON(&location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (location.Latitude == nil) != (location.Longitude == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "latitude and longitude must be provided together"})
+		return
+	}
+	if location.Latitude == nil && location.City == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide latitude and longitude or city"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	city := strings.TrimSpace(location.City)
+	var lat, lon float64
+	if location.Latitude != nil {
+		lat, lon = *location.Latitude, *location.Longitude
+	} else {
+		// Kota tanpa koordinat dicari dari tabel cities
+		err = DB.QueryRow("SELECT name, latitude, longitude FROM cities WHERE LOWER(name) = LOWER($1)", city).Scan(&city, &lat, &lon)
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown city, please provide latitude and longitude"})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	lat, lon = reducePrecision(lat), reducePrecision(lon)
+
+	_, err = DB.Exec("UPDATE users SET city = $1, latitude = $2, longitude = $3, updated_at = NOW() WHERE id = $4", nullIfEmpty(city), lat, lon, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"city":      city,
+			"latitude":  lat,
+			"longitude": lon,
+		},
+	})
+}
+
+func DeleteLocation(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	_, err = DB.Exec("UPDATE users SET city = NULL, latitude = NULL, longitude = NULL, updated_at = NOW() WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location deleted successfully"})
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", -6.2, 106.8, -6.2, 106.8, 0},
+		{"Jakarta to Bandung", -6.2088, 106.8456, -6.9175, 107.6191, 116.3},
+		{"Jakarta to Surabaya", -6.2088, 106.8456, -7.2575, 112.7521, 662.6},
+		{"one degree on the equator", 0, 0, 0, 1, 111.19},
+		{"across the antimeridian", 0, 179.5, 0, -179.5, 111.19},
+		{"antipodal", 0, 0, 0, 180, math.Pi * earthRadiusKm},
+		{"pole to pole", 90, 0, -90, 0, math.Pi * earthRadiusKm},
+	}
+	for _, tt := range tests {
+		got := haversineKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+		if math.IsNaN(got) || math.Abs(got-tt.want) > 0.5 {
+			t.Errorf("%s: haversineKm() = %.2f, want %.2f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHaversineKmNearlyAntipodal(t *testing.T) {
+	// Rounding pushes the haversine argument above 1 for some of these
+	for lon := -180.0; lon <= 180; lon += 0.5 {
+		if got := haversineKm(45, lon, -45, lon+180); math.IsNaN(got) {
+			t.Fatalf("haversineKm(45, %v, -45, %v) = NaN", lon, lon+180)
+		}
+	}
+}
+
+// inBox reports whether the point lies in the bounding box
+func inBox(lat, lon, minLat, maxLat float64, lonRanges []lonRange) bool {
+	if lat < minLat || lat > maxLat {
+		return false
+	}
+	for _, r := range lonRanges {
+		if lon >= r.min && lon <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBoundingBox(t *testing.T) {
+	tests := []struct {
+		name          string
+		lat, lon      float64
+		radiusKm      float64
+		wantLonRanges int
+	}{
+		{"Jakarta", -6.2, 106.8, 50, 1},
+		{"west of the antimeridian", -17.7, 179.9, 100, 2},
+		{"east of the antimeridian", -17.7, -179.9, 100, 2},
+		{"near the north pole", 89.9, 10, 50, 1},
+		{"near the south pole", -89.5, 10, 100, 1},
+		{"whole earth", 0, 0, 30000, 1},
+	}
+	for _, tt := range tests {
+		minLat, maxLat, lonRanges := boundingBox(tt.lat, tt.lon, tt.radiusKm)
+		if len(lonRanges) != tt.wantLonRanges {
+			t.Errorf("%s: boundingBox() longitude ranges = %v, want %d", tt.name, lonRanges, tt.wantLonRanges)
+		}
+		if minLat < -90 || maxLat > 90 {
+			t.Errorf("%s: boundingBox() latitudes %v..%v out of range", tt.name, minLat, maxLat)
+		}
+		for _, r := range lonRanges {
+			if r.min < -180 || r.max > 180 || r.min > r.max {
+				t.Errorf("%s: boundingBox() invalid longitude range %v", tt.name, r)
+			}
+		}
+
+		// Every point within the radius must be inside the box
+		for bearing := 0.0; bearing < 360; bearing += 5 {
+			for _, fraction := range []float64{0.5, 0.99} {
+				lat, lon := destination(tt.lat, tt.lon, bearing, tt.radiusKm*fraction)
+				if haversineKm(tt.lat, tt.lon, lat, lon) > tt.radiusKm {
+					continue
+				}
+				if !inBox(lat, lon, minLat, maxLat, lonRanges) {
+					t.Errorf("%s: point %.4f,%.4f within %v km is outside the box %v..%v %v", tt.name, lat, lon, tt.radiusKm, minLat, maxLat, lonRanges)
+				}
+			}
+		}
+	}
+}
+
+// destination returns the point distanceKm away from lat,lon along the bearing
+func destination(lat, lon, bearing, distanceKm float64) (float64, float64) {
+	lat1, lon1 := lat*math.Pi/180, lon*math.Pi/180
+	theta, delta := bearing*math.Pi/180, distanceKm/earthRadiusKm
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(delta) + math.Cos(lat1)*math.Sin(delta)*math.Cos(theta))
+	lon2 := lon1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(lat1), math.Cos(delta)-math.Sin(lat1)*math.Sin(lat2))
+	return lat2 * 180 / math.Pi, math.Mod(lon2*180/math.Pi+540, 360) - 180
+}
+
+func TestParseNear(t *testing.T) {
+	tests := []struct {
+		near     string
+		lat, lon float64
+		ok       bool
+	}{
+		{"-6.2,106.8", -6.2, 106.8, true},
+		{" -6.2 , 106.8 ", -6.2, 106.8, true},
+		{"90,180", 90, 180, true},
+		{"91,0", 0, 0, false},
+		{"0,-181", 0, 0, false},
+		{"-6.2", 0, 0, false},
+		{"a,b", 0, 0, false},
+	}
+	for _, tt := range tests {
+		lat, lon, ok := parseNear(tt.near)
+		if ok != tt.ok || lat != tt.lat || lon != tt.lon {
+			t.Errorf("parseNear(%q) = %v, %v, %t, want %v, %v, %t", tt.near, lat, lon, ok, tt.lat, tt.lon, tt.ok)
+		}
+	}
+}
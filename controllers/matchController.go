@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"CatsSocial/mailer"
+	"CatsSocial/webhooks"
 	"database/sql"
 	"log"
 	"net/http"
@@ -37,6 +40,17 @@ func CreateMatch(c *gin.Context) {
 		return
 	}
 
+	// Unverified users can browse cats but not send match requests
+	verified, err := isEmailVerified(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !verified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Verify your email address before sending match requests"})
+		return
+	}
+
 	// // Cek apakah cat yang dimaksud milik pengguna
 	// var ownerID int
 	// err = DB.QueryRow("SELECT user_id FROM cats WHERE id = $1", matchRequest.UserCatID).Scan(&ownerID)
@@ -58,7 +72,7 @@ func CreateMatch(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User cat not found"})
 		return
 	}
-	err = DB.QueryRow("SELECT sex FROM cats WHERE id = $1", matchRequest.MatchCatID).Scan(&matchCatSex)
+	err = DB.QueryRow("SELECT sex FROM cats WHERE id = $1 AND hidden_at IS NULL", matchRequest.MatchCatID).Scan(&matchCatSex)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match cat not found"})
 		return
@@ -69,6 +83,40 @@ func CreateMatch(c *gin.Context) {
 		return
 	}
 
+	// Cek preferensi pemilik kucing yang dituju
+	reason, err := checkMatchPreference(DB, matchRequest.MatchCatID, matchRequest.UserCatID)
+	if err != nil {
+		log.Println("Error checking match preference:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check match preference"})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
+	// Cek silsilah kedua kucing untuk mencegah perkawinan sedarah
+	userCatID, err := strconv.Atoi(matchRequest.UserCatID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userCatId"})
+		return
+	}
+	matchCatID, err := strconv.Atoi(matchRequest.MatchCatID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid matchCatId"})
+		return
+	}
+	_, reason, err = checkInbreeding(DB, userCatID, matchCatID)
+	if err != nil {
+		log.Println("Error checking inbreeding:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check pedigree"})
+		return
+	}
+	if reason != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+
 	// Cek apakah kedua kucing sudah dipasangkan sebelumnya
 	var isMatched bool
 	err = DB.QueryRow("SELECT status FROM match_cats WHERE (issuedCatId = $1 AND receiverCatId = $2) OR (issuedCatId = $2 AND receiverCatId = $1) AND deleted_at IS NULL", matchRequest.UserCatID, matchRequest.MatchCatID).Scan(&isMatched)
@@ -94,6 +142,15 @@ func CreateMatch(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match cat not found"})
 		return
 	}
+	blocked, err := isBlocked(DB, userID, matchCatOwnerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if blocked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Match requests between these users are not allowed"})
+		return
+	}
 	// if userCatOwnerID == matchCatOwnerID {
 	// 	c.JSON(http.StatusBadRequest, gin.H{"error": "Both cats belong to the same owner"})
 	// 	return
@@ -104,12 +161,39 @@ func CreateMatch(c *gin.Context) {
 	// }
 
 	// Tambahkan permintaan pencocokan kucing ke database
-	_, err = DB.Exec("INSERT INTO match_cats (issuedId, issuedCatId, receiverId, receiverCatId, message, status) VALUES ($1, $2, $3, $4, $5, false)",
-		userID, matchRequest.UserCatID, matchCatOwnerID, matchRequest.MatchCatID, matchRequest.Message)
+	tx, err := DB.Begin()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add match request"})
 		return
 	}
+	defer tx.Rollback()
+
+	var matchID int
+	err = tx.QueryRow("INSERT INTO match_cats (issuedId, issuedCatId, receiverId, receiverCatId, message, status) VALUES ($1, $2, $3, $4, $5, false) RETURNING id",
+		userID, matchRequest.UserCatID, matchCatOwnerID, matchRequest.MatchCatID, matchRequest.Message).Scan(&matchID)
+	if err == nil {
+		err = webhooks.Enqueue(tx, webhooks.MatchCreated, []int{userID, matchCatOwnerID}, gin.H{
+			"id":            strconv.Itoa(matchID),
+			"issuedCatId":   matchRequest.UserCatID,
+			"receiverCatId": matchRequest.MatchCatID,
+			"message":       matchRequest.Message,
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add match request"})
+		return
+	}
+
+	notifyUser(DB, matchCatOwnerID, events.MatchReceived, gin.H{
+		"matchId":    strconv.Itoa(matchID),
+		"userCatId":  matchRequest.MatchCatID,
+		"matchCatId": matchRequest.UserCatID,
+		"message":    matchRequest.Message,
+	})
+	mailMatch(DB, matchCatOwnerID, mailer.MatchReceived, matchRequest.MatchCatID, matchRequest.UserCatID, matchRequest.Message)
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Match request sent successfully"})
 	defer DB.Close()
@@ -277,8 +361,9 @@ func ApproveMatch(c *gin.Context) {
 
 	var issuedCatId int
 	var receiverCatId int
-	var deletedAt time.Time
-	err = DB.QueryRow("SELECT status, issuedCatId, receiverCatId, deleted_at FROM match_cats WHERE id = $1 AND receiverId = $2", approval.MatchID, userID).Scan(&status, &issuedCatId, &receiverCatId, &deletedAt)
+	var issuedId int
+	var deletedAt sql.NullTime
+	err = DB.QueryRow("SELECT status, issuedId, issuedCatId, receiverCatId, deleted_at FROM match_cats WHERE id = $1 AND "+receivedMatchSQL("$2"), approval.MatchID, userID).Scan(&status, &issuedId, &issuedCatId, &receiverCatId, &deletedAt)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match request not found"})
 		return
@@ -291,29 +376,64 @@ func ApproveMatch(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match Id is no longer valid"})
 		return
 	}
-	if !status && !deletedAt.IsZero() {
+	if !status && deletedAt.Valid {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match Id is no longer valid"})
 		return
 	}
 
+	// Optionally require up-to-date vaccinations before breeding
+	if vaccinationRequiredOnApprove() {
+		for _, catID := range []int{issuedCatId, receiverCatId} {
+			vaccinated, err := hasValidVaccination(DB, catID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check health records"})
+				return
+			}
+			if !vaccinated {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Cat " + strconv.Itoa(catID) + " has no up-to-date vaccination"})
+				return
+			}
+		}
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve match request"})
+		return
+	}
+	defer tx.Rollback()
+
 	// Approve cat matching request
-	_, err = DB.Exec("UPDATE match_cats SET status = true WHERE id = $1", approval.MatchID)
+	_, err = tx.Exec("UPDATE match_cats SET status = true WHERE id = $1", approval.MatchID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve match request"})
 		return
 	}
 
-	_, err = DB.Exec("UPDATE match_cats SET status = true, deleted_at = NOW() WHERE (issuedCatId = $1 OR receiverCatId = $2) AND id != $3", issuedCatId, receiverCatId, approval.MatchID)
+	_, err = tx.Exec("UPDATE match_cats SET status = true, deleted_at = NOW() WHERE (issuedCatId = $1 OR receiverCatId = $2) AND id != $3", issuedCatId, receiverCatId, approval.MatchID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve match request"})
 		return
 	}
-	_, err = DB.Exec("UPDATE cats SET has_matched = true WHERE id = $1 or id = $2", issuedCatId, receiverCatId)
+	_, err = tx.Exec("UPDATE cats SET has_matched = true WHERE id = $1 or id = $2", issuedCatId, receiverCatId)
+	if err == nil {
+		err = webhooks.Enqueue(tx, webhooks.MatchApproved, []int{issuedId, userID}, gin.H{
+			"id":            approval.MatchID,
+			"issuedCatId":   strconv.Itoa(issuedCatId),
+			"receiverCatId": strconv.Itoa(receiverCatId),
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve match request"})
 		return
 	}
 
+	notifyUser(DB, issuedId, events.MatchApproved, gin.H{"matchId": approval.MatchID})
+	mailMatch(DB, issuedId, mailer.MatchApproved, issuedCatId, receiverCatId, "")
+
 	c.JSON(http.StatusOK, gin.H{"message": "Match request approved successfully"})
 	defer DB.Close()
 }
@@ -344,8 +464,9 @@ func RejectMatch(c *gin.Context) {
 	var status bool
 	var issuedCatId int
 	var receiverCatId int
-	var deletedAt time.Time
-	err = DB.QueryRow("SELECT status, issuedCatId, receiverCatId, deleted_at FROM match_cats WHERE id = $1 AND receiverId = $2", rejection.MatchID, userID).Scan(&status, &issuedCatId, &receiverCatId, &deletedAt)
+	var issuedId int
+	var deletedAt sql.NullTime
+	err = DB.QueryRow("SELECT status, issuedId, issuedCatId, receiverCatId, deleted_at FROM match_cats WHERE id = $1 AND "+receivedMatchSQL("$2"), rejection.MatchID, userID).Scan(&status, &issuedId, &issuedCatId, &receiverCatId, &deletedAt)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match request not found"})
 		return
@@ -358,18 +479,39 @@ func RejectMatch(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match Id is no longer valid"})
 		return
 	}
-	if !status && !deletedAt.IsZero() {
+	if !status && deletedAt.Valid {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match Id is no longer valid"})
 		return
 	}
 
 	// Reject cat matching request by updating deleted_at column
-	_, err = DB.Exec("UPDATE match_cats SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1", rejection.MatchID)
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject match request"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE match_cats SET deleted_at = CURRENT_TIMESTAMP WHERE id = $1", rejection.MatchID)
+	if err == nil {
+		err = webhooks.Enqueue(tx, webhooks.MatchRejected, []int{issuedId, userID}, gin.H{
+			"id":            rejection.MatchID,
+			"issuedCatId":   strconv.Itoa(issuedCatId),
+			"receiverCatId": strconv.Itoa(receiverCatId),
+		})
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject match request"})
 		return
 	}
 
+	notifyUser(DB, issuedId, events.MatchRejected, gin.H{"matchId": rejection.MatchID})
+	mailMatch(DB, issuedId, mailer.MatchRejected, issuedCatId, receiverCatId, "")
+	notifyFavoritersIfAvailable(DB, issuedCatId, receiverCatId)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Match request rejected successfully"})
 	defer DB.Close()
 }
@@ -392,10 +534,11 @@ func DeleteMatch(c *gin.Context) {
 	// Check if match request exists in the database and the user is the issuer
 	var status bool
 	var issuedId int
+	var receiverId int
 	var issuedCatId int
 	var receiverCatId int
-	var deletedAt time.Time
-	err = DB.QueryRow("SELECT status, issuedId, issuedCatId, receiverCatId, deleted_at FROM match_cats WHERE id = $1 AND receiverId = $2", matchID, userID).Scan(&status, &issuedId, &issuedCatId, &receiverCatId, &deletedAt)
+	var deletedAt sql.NullTime
+	err = DB.QueryRow("SELECT status, issuedId, receiverId, issuedCatId, receiverCatId, deleted_at FROM match_cats WHERE id = $1", matchID).Scan(&status, &issuedId, &receiverId, &issuedCatId, &receiverCatId, &deletedAt)
 	if err == sql.ErrNoRows {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match request not found"})
 		return
@@ -413,7 +556,7 @@ func DeleteMatch(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match Id is already Approved"})
 		return
 	}
-	if !status && !deletedAt.IsZero() {
+	if !status && deletedAt.Valid {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Match Id is already Reject"})
 		return
 	}
@@ -425,6 +568,20 @@ func DeleteMatch(c *gin.Context) {
 		return
 	}
 
+	notifyUser(DB, receiverId, events.MatchWithdrawn, gin.H{"matchId": matchID})
+	notifyFavoritersIfAvailable(DB, issuedCatId, receiverCatId)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Match request deleted successfully"})
 	defer DB.Close()
 }
+
+// mailMatch mails the owner of catID about a match with matchCatID
+func mailMatch(DB *sql.DB, userID int, template string, catID, matchCatID interface{}, message string) {
+	var catName, matchCatName string
+	err := DB.QueryRow("SELECT (SELECT name FROM cats WHERE id = $1), (SELECT name FROM cats WHERE id = $2)", catID, matchCatID).Scan(&catName, &matchCatName)
+	if err != nil {
+		log.Println("Error retrieving cat names for mail:", err)
+		return
+	}
+	mailUser(DB, userID, template, gin.H{"catName": catName, "matchCatName": matchCatName, "message": message})
+}
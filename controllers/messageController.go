@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkMatchParty responds with the proper error and returns false when the
+// match request does not exist or the user is neither its issuer nor receiver.
+// On success it returns the id of the other party and whether the match is still active.
+func checkMatchParty(c *gin.Context, DB *sql.DB, matchID string, userID int) (int, bool, bool) {
+	var issuedID, receiverID int
+	var deletedAt sql.NullTime
+	err := DB.QueryRow("SELECT issuedId, receiverId, deleted_at FROM match_cats WHERE id = $1", matchID).Scan(&issuedID, &receiverID, &deletedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Match request not found"})
+		return 0, false, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve match request"})
+		return 0, false, false
+	}
+
+	switch userID {
+	case issuedID:
+		return receiverID, !deletedAt.Valid, true
+	case receiverID:
+		return issuedID, !deletedAt.Valid, true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to access this conversation"})
+	return 0, false, false
+}
+
+func GetMatchMessages(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, must be between 1 and 100"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	matchID := c.Param("id")
+	if _, _, ok := checkMatchParty(c, DB, matchID, userID); !ok {
+		return
+	}
+
+	var total, unread int
+	err = DB.QueryRow("SELECT COUNT(*), COUNT(*) FILTER (WHERE sender_id != $2 AND read_at IS NULL) FROM match_messages WHERE match_id = $1", matchID, userID).Scan(&total, &unread)
+	if err != nil {
+		log.Println("Error counting messages:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	rows, err := DB.Query("SELECT id, sender_id, body, read_at, created_at FROM match_messages WHERE match_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3", matchID, limit, offset)
+	if err != nil {
+		log.Println("Error retrieving messages:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+	defer rows.Close()
+
+	messages := []gin.H{}
+	for rows.Next() {
+		var message struct {
+			ID        int
+			SenderID  int
+			Body      string
+			ReadAt    sql.NullTime
+			CreatedAt time.Time
+		}
+		if err := rows.Scan(&message.ID, &message.SenderID, &message.Body, &message.ReadAt, &message.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+			return
+		}
+
+		var readAt interface{}
+		if message.ReadAt.Valid {
+			readAt = message.ReadAt.Time.Format(time.RFC3339)
+		}
+		messages = append(messages, gin.H{
+			"id":        strconv.Itoa(message.ID),
+			"senderId":  strconv.Itoa(message.SenderID),
+			"isMine":    message.SenderID == userID,
+			"message":   message.Body,
+			"readAt":    readAt,
+			"createdAt": message.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    messages,
+		"meta": gin.H{
+			"limit":       limit,
+			"offset":      offset,
+			"total":       total,
+			"unreadCount": unread,
+		},
+	})
+}
+
+func SendMatchMessage(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var message struct {
+		Message string `json:"message" binding:"required,min=1,max=1000"`
+	}
+	if err := c.ShouldBindJSON(&message); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	matchID := c.Param("id")
+	otherUserID, active, ok := checkMatchParty(c, DB, matchID, userID)
+	if !ok {
+		return
+	}
+	if !active {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Match request is no longer active"})
+		return
+	}
+
+	var messageID int
+	var createdAt time.Time
+	err = DB.QueryRow("INSERT INTO match_messages (match_id, sender_id, body) VALUES ($1, $2, $3) RETURNING id, created_at", matchID, userID, message.Message).Scan(&messageID, &createdAt)
+	if err != nil {
+		log.Println("Error adding message:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send message"})
+		return
+	}
+
+	events.Publish(DB, events.Event{
+		Type:   events.MessageCreated,
+		UserID: otherUserID,
+		Data: gin.H{
+			"matchId":   matchID,
+			"messageId": strconv.Itoa(messageID),
+			"message":   message.Message,
+		},
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        strconv.Itoa(messageID),
+			"createdAt": createdAt.Format(time.RFC3339),
+		},
+	})
+}
+
+func MarkMatchMessagesRead(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	matchID := c.Param("id")
+	if _, _, ok := checkMatchParty(c, DB, matchID, userID); !ok {
+		return
+	}
+
+	// Only messages from the other party can be marked as read
+	result, err := DB.Exec("UPDATE match_messages SET read_at = NOW() WHERE match_id = $1 AND sender_id != $2 AND read_at IS NULL", matchID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark messages as read"})
+		return
+	}
+	affected, _ := result.RowsAffected()
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{"readCount": affected}})
+}
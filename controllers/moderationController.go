@@ -0,0 +1,438 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type reportRequest struct {
+	Reason  string `json:"reason" binding:"required,oneof=spam inappropriate harassment fraud animal_welfare other"`
+	Details string `json:"details" binding:"max=500"`
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// flaggedWords returns the words of the comma separated MODERATION_WORDS
+// list found in the text, matched case-insensitively on word boundaries
+func flaggedWords(text string) []string {
+	words := []string{}
+	for _, word := range strings.Split(os.Getenv("MODERATION_WORDS"), ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, regexp.QuoteMeta(word))
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	pattern := regexp.MustCompile(`(?i)\b(` + strings.Join(words, "|") + `)\b`)
+	found := []string{}
+	seen := map[string]bool{}
+	for _, match := range pattern.FindAllString(text, -1) {
+		match = strings.ToLower(match)
+		if !seen[match] {
+			seen[match] = true
+			found = append(found, match)
+		}
+	}
+	return found
+}
+
+// flagCat records the result of the word filter on the cat and queues a
+// report for the moderators unless one is already open
+func flagCat(db execer, catID interface{}, words []string) error {
+	if len(words) == 0 {
+		_, err := db.Exec("UPDATE cats SET flagged_at = NULL WHERE id = $1", catID)
+		return err
+	}
+
+	_, err := db.Exec("UPDATE cats SET flagged_at = COALESCE(flagged_at, NOW()) WHERE id = $1", catID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO reports (target_type, target_id, reason, details)
+		SELECT 'cat', $1, 'word_filter', $2
+		WHERE NOT EXISTS(SELECT 1 FROM reports WHERE target_type = 'cat' AND target_id = $1 AND reason = 'word_filter' AND status = 'open')`,
+		catID, "Description contains: "+strings.Join(words, ", "))
+	return err
+}
+
+// createReport stores the report of the authenticated user on the target
+func createReport(c *gin.Context, DB *sql.DB, reporterID int, targetType string, targetID int) {
+	var report reportRequest
+	if err := c.ShouldBindJSON(&report); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var reportID int
+	var createdAt time.Time
+	err := DB.QueryRow("INSERT INTO reports (reporter_id, target_type, target_id, reason, details) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		reporterID, targetType, targetID, report.Reason, nullIfEmpty(report.Details)).Scan(&reportID, &createdAt)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already reported this " + targetType})
+		return
+	} else if err != nil {
+		log.Println("Error adding report:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add report"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        strconv.Itoa(reportID),
+			"createdAt": createdAt.Format(time.RFC3339),
+		},
+	})
+}
+
+func ReportCat(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var catID, ownerID int
+	err = DB.QueryRow("SELECT id, user_id FROM cats WHERE id = $1 AND deleted_at IS NULL", c.Param("id")).Scan(&catID, &ownerID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if ownerID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot report your own cat"})
+		return
+	}
+
+	createReport(c, DB, userID, "cat", catID)
+}
+
+func ReportUser(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var targetID int
+	err = DB.QueryRow("SELECT id FROM users WHERE id = $1 AND deleted_at IS NULL", c.Param("id")).Scan(&targetID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if targetID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot report yourself"})
+		return
+	}
+
+	createReport(c, DB, userID, "user", targetID)
+}
+
+func ReportMessage(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// Only the parties of the conversation can see, and report, its messages
+	if _, _, ok := checkMatchParty(c, DB, c.Param("id"), userID); !ok {
+		return
+	}
+
+	var messageID, senderID int
+	err = DB.QueryRow("SELECT id, sender_id FROM match_messages WHERE id = $1 AND match_id = $2", c.Param("messageId"), c.Param("id")).Scan(&messageID, &senderID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if senderID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot report your own message"})
+		return
+	}
+
+	createReport(c, DB, userID, "message", messageID)
+}
+
+func AdminGetReports(c *gin.Context) {
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	status := c.DefaultQuery("status", "open")
+	if status != "open" && status != "resolved" && status != "dismissed" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status value"})
+		return
+	}
+	query := " FROM reports WHERE status = $1"
+	args := []interface{}{status}
+	if targetType := c.Query("targetType"); targetType != "" {
+		if targetType != "cat" && targetType != "user" && targetType != "message" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid targetType value"})
+			return
+		}
+		args = append(args, targetType)
+		query += " AND target_type = $2"
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*)"+query, args...).Scan(&total); err != nil {
+		log.Println("Error counting reports:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+		return
+	}
+
+	// Open reports are oldest first so the queue is worked in order
+	order := " ORDER BY created_at ASC, id ASC"
+	if status != "open" {
+		order = " ORDER BY resolved_at DESC, id DESC"
+	}
+	args = append(args, limit, offset)
+	rows, err := DB.Query("SELECT id, reporter_id, target_type, target_id, reason, details, status, action, resolved_by, resolved_at, created_at"+query+order+
+		" LIMIT $"+strconv.Itoa(len(args)-1)+" OFFSET $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		log.Println("Error retrieving reports:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+		return
+	}
+	defer rows.Close()
+
+	reports := []gin.H{}
+	for rows.Next() {
+		var report struct {
+			ID         int
+			ReporterID sql.NullInt64
+			TargetType string
+			TargetID   int
+			Reason     string
+			Details    sql.NullString
+			Status     string
+			Action     sql.NullString
+			ResolvedBy sql.NullInt64
+			ResolvedAt sql.NullTime
+			CreatedAt  time.Time
+		}
+		if err := rows.Scan(&report.ID, &report.ReporterID, &report.TargetType, &report.TargetID, &report.Reason, &report.Details,
+			&report.Status, &report.Action, &report.ResolvedBy, &report.ResolvedAt, &report.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+			return
+		}
+		reports = append(reports, gin.H{
+			"id":         strconv.Itoa(report.ID),
+			"reporterId": nullInt64Value(report.ReporterID),
+			"targetType": report.TargetType,
+			"targetId":   strconv.Itoa(report.TargetID),
+			"reason":     report.Reason,
+			"details":    report.Details.String,
+			"status":     report.Status,
+			"action":     report.Action.String,
+			"resolvedBy": nullInt64Value(report.ResolvedBy),
+			"resolvedAt": formatNullTime(report.ResolvedAt),
+			"createdAt":  report.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": reports, "meta": gin.H{"limit": limit, "offset": offset, "total": total}})
+}
+
+// ResolveReport applies the moderation action to the target of the report
+// and closes every open report on the same target
+func ResolveReport(c *gin.Context) {
+	moderatorID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Action string `json:"action" binding:"required,oneof=hide_cat suspend_user dismiss"`
+		Reason string `json:"reason" binding:"max=500"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var targetType, status string
+	var targetID int
+	err = DB.QueryRow("SELECT target_type, target_id, status FROM reports WHERE id = $1", c.Param("id")).Scan(&targetType, &targetID, &status)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status != "open" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Report is already closed"})
+		return
+	}
+
+	// The user to suspend is the target itself, the owner of the cat or
+	// the sender of the message
+	var offenderID int
+	switch targetType {
+	case "user":
+		offenderID = targetID
+	case "cat":
+		err = DB.QueryRow("SELECT user_id FROM cats WHERE id = $1", targetID).Scan(&offenderID)
+	case "message":
+		err = DB.QueryRow("SELECT sender_id FROM match_messages WHERE id = $1", targetID).Scan(&offenderID)
+	}
+	if err == sql.ErrNoRows && request.Action != "dismiss" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reported " + targetType + " no longer exists"})
+		return
+	} else if err != nil && err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if request.Action == "hide_cat" && targetType != "cat" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only reported cats can be hidden"})
+		return
+	}
+	if request.Action == "suspend_user" && offenderID == moderatorID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot suspend yourself"})
+		return
+	}
+	// Moderators and admins can only be suspended by admins, like in AdminSuspendUser
+	if request.Action == "suspend_user" && !configurations.IsAdmin(c) {
+		var offenderRole string
+		if err := DB.QueryRow("SELECT role FROM users WHERE id = $1", offenderID).Scan(&offenderRole); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if offenderRole != configurations.RoleUser {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can suspend moderators and admins"})
+			return
+		}
+	}
+
+	tx, err := beginCatTx(DB, moderatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve report"})
+		return
+	}
+	defer tx.Rollback()
+
+	newStatus := "resolved"
+	switch request.Action {
+	case "hide_cat":
+		_, err = tx.Exec("UPDATE cats SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = $1", targetID)
+	case "suspend_user":
+		_, err = tx.Exec("UPDATE users SET suspended_at = COALESCE(suspended_at, NOW()), suspension_reason = COALESCE($1, suspension_reason), updated_at = NOW() WHERE id = $2",
+			nullIfEmpty(request.Reason), offenderID)
+	case "dismiss":
+		newStatus = "dismissed"
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE reports SET status = $1, action = $2, resolved_by = $3, resolved_at = NOW() WHERE target_type = $4 AND target_id = $5 AND status = 'open'",
+			newStatus, request.Action, moderatorID, targetType, targetID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error resolving report:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Report " + newStatus + " successfully"})
+}
+
+func AdminUnhideCat(c *gin.Context) {
+	moderatorID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	tx, err := beginCatTx(DB, moderatorID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unhide cat"})
+		return
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("UPDATE cats SET hidden_at = NULL WHERE id = $1 AND hidden_at IS NOT NULL", c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unhide cat"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hidden cat not found"})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unhide cat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cat unhidden successfully"})
+}
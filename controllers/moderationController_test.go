@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlaggedWords(t *testing.T) {
+	tests := []struct {
+		name  string
+		words string
+		text  string
+		want  []string
+	}{
+		{"no list", "", "cheap kittens, scam", nil},
+		{"only separators", " , ,", "cheap kittens, scam", nil},
+		{"no match", "scam,jual", "A friendly tabby", []string{}},
+		{"case insensitive", "scam", "Total SCAM here", []string{"scam"}},
+		{"word boundaries", "scam", "scampi and scammer", []string{}},
+		{"punctuation", "scam", "scam! (scam)", []string{"scam"}},
+		{"every word once", " scam , jual ", "Jual kucing, bukan scam. JUAL murah", []string{"jual", "scam"}},
+		{"phrase", "free money", "Get FREE money now", []string{"free money"}},
+		{"regexp characters are literal", "a.b", "axb a.b", []string{"a.b"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("MODERATION_WORDS", tt.words)
+		if got := flaggedWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: flaggedWords(%q) = %#v, want %#v", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notifyUser stores the notification in the inbox of the user and pushes it
+// to the connected clients. Failures are logged only, the action that caused
+// the notification has already succeeded.
+func notifyUser(DB *sql.DB, userID int, eventType string, data gin.H) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Println("Error encoding notification:", err)
+		return
+	}
+
+	var notificationID int
+	var createdAt time.Time
+	err = DB.QueryRow("INSERT INTO notifications (user_id, type, data) VALUES ($1, $2, $3) RETURNING id, created_at", userID, eventType, string(payload)).Scan(&notificationID, &createdAt)
+	if err != nil {
+		log.Println("Error adding notification:", err)
+		return
+	}
+
+	data["notificationId"] = strconv.Itoa(notificationID)
+	events.Publish(DB, events.Event{
+		Type:      eventType,
+		UserID:    userID,
+		Data:      data,
+		CreatedAt: createdAt,
+	})
+}
+
+func GetNotifications(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, must be between 1 and 100"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+	unreadOnly := false
+	if unreadStr := c.Query("unread"); unreadStr != "" {
+		unreadOnly, err = strconv.ParseBool(unreadStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unread value"})
+			return
+		}
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var total, unread int
+	err = DB.QueryRow("SELECT COUNT(*), COUNT(*) FILTER (WHERE read_at IS NULL) FROM notifications WHERE user_id = $1", userID).Scan(&total, &unread)
+	if err != nil {
+		log.Println("Error counting notifications:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+
+	query := "SELECT id, type, data, read_at, created_at FROM notifications WHERE user_id = $1"
+	if unreadOnly {
+		query += " AND read_at IS NULL"
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3"
+
+	rows, err := DB.Query(query, userID, limit, offset)
+	if err != nil {
+		log.Println("Error retrieving notifications:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+	defer rows.Close()
+
+	notifications := []gin.H{}
+	for rows.Next() {
+		var notification struct {
+			ID        int
+			Type      string
+			Data      []byte
+			ReadAt    sql.NullTime
+			CreatedAt time.Time
+		}
+		if err := rows.Scan(&notification.ID, &notification.Type, &notification.Data, &notification.ReadAt, &notification.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+			return
+		}
+
+		var readAt interface{}
+		if notification.ReadAt.Valid {
+			readAt = notification.ReadAt.Time.Format(time.RFC3339)
+		}
+		notifications = append(notifications, gin.H{
+			"id":        strconv.Itoa(notification.ID),
+			"type":      notification.Type,
+			"data":      json.RawMessage(notification.Data),
+			"readAt":    readAt,
+			"createdAt": notification.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data":    notifications,
+		"meta": gin.H{
+			"limit":       limit,
+			"offset":      offset,
+			"total":       total,
+			"unreadCount": unread,
+		},
+	})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	result, err := DB.Exec("UPDATE notifications SET read_at = COALESCE(read_at, NOW()) WHERE id = $1 AND user_id = $2", c.Param("id"), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification as read"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	result, err := DB.Exec("UPDATE notifications SET read_at = NOW() WHERE user_id = $1 AND read_at IS NULL", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications as read"})
+		return
+	}
+	affected, _ := result.RowsAffected()
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{"readCount": affected}})
+}
@@ -0,0 +1,778 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/mailer"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+// Organization roles, managers manage the cats of the organization and
+// owners also manage its members
+var (
+	managerRoles = []string{"owner", "manager"}
+	memberRoles  = []string{"owner", "manager", "viewer"}
+)
+
+// catAccessSQL is the SQL condition of the cats the user can access: their
+// own cats, and the cats of the organizations where they have one of the roles
+func catAccessSQL(catTable, userArg string, roles []string) string {
+	return "((" + catTable + ".organization_id IS NULL AND " + catTable + ".user_id = " + userArg + ") OR EXISTS(SELECT 1 FROM organization_members" +
+		" WHERE organization_members.organization_id = " + catTable + ".organization_id AND organization_members.user_id = " + userArg +
+		" AND organization_members.role IN ('" + strings.Join(roles, "', '") + "')))"
+}
+
+// receivedMatchSQL is the SQL condition of the match requests the user can
+// answer, the requests for the cats they manage
+func receivedMatchSQL(userArg string) string {
+	return "EXISTS(SELECT 1 FROM cats WHERE cats.id = match_cats.receiverCatId AND " + catAccessSQL("cats", userArg, managerRoles) + ")"
+}
+
+// getOrganizationRole returns the role of the user in the organization, or
+// answers 404 when the user is not a member
+func getOrganizationRole(c *gin.Context, DB *sql.DB, orgID string, userID int) (string, bool) {
+	var role string
+	err := DB.QueryRow("SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2", orgID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		return "", false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return role, true
+}
+
+func CreateOrganization(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Name string `json:"name" binding:"required,min=1,max=100"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+	defer tx.Rollback()
+
+	// The creator is the first owner
+	var orgID int
+	var createdAt time.Time
+	err = tx.QueryRow("INSERT INTO organizations (name, created_by) VALUES ($1, $2) RETURNING id, created_at", request.Name, userID).Scan(&orgID, &createdAt)
+	if err == nil {
+		_, err = tx.Exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, 'owner')", orgID, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error creating organization:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        strconv.Itoa(orgID),
+			"name":      request.Name,
+			"role":      "owner",
+			"createdAt": createdAt.Format(time.RFC3339),
+		},
+	})
+}
+
+func GetOrganizations(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	rows, err := DB.Query(`SELECT o.id, o.name, m.role, o.created_at FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = $1 ORDER BY o.name`, userID)
+	if err != nil {
+		log.Println("Error retrieving organizations:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organizations"})
+		return
+	}
+	defer rows.Close()
+
+	organizations := []gin.H{}
+	for rows.Next() {
+		var orgID int
+		var name, role string
+		var createdAt time.Time
+		if err := rows.Scan(&orgID, &name, &role, &createdAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organizations"})
+			return
+		}
+		organizations = append(organizations, gin.H{
+			"id":        strconv.Itoa(orgID),
+			"name":      name,
+			"role":      role,
+			"createdAt": createdAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organizations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": organizations})
+}
+
+// GetOrganization returns the organization with its members, for members only
+func GetOrganization(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	orgID := c.Param("id")
+	role, ok := getOrganizationRole(c, DB, orgID, userID)
+	if !ok {
+		return
+	}
+
+	var name string
+	var createdAt time.Time
+	var catCount int
+	err = DB.QueryRow("SELECT name, created_at, (SELECT COUNT(*) FROM cats WHERE organization_id = organizations.id AND deleted_at IS NULL) FROM organizations WHERE id = $1", orgID).
+		Scan(&name, &createdAt, &catCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows, err := DB.Query(`SELECT u.id, u.name, u.email, m.role, m.created_at FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 ORDER BY m.created_at`, orgID)
+	if err != nil {
+		log.Println("Error retrieving organization members:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organization"})
+		return
+	}
+	defer rows.Close()
+
+	members := []gin.H{}
+	for rows.Next() {
+		var memberID int
+		var memberName, email, memberRole string
+		var joinedAt time.Time
+		if err := rows.Scan(&memberID, &memberName, &email, &memberRole, &joinedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organization"})
+			return
+		}
+		members = append(members, gin.H{
+			"userId":   strconv.Itoa(memberID),
+			"name":     memberName,
+			"email":    email,
+			"role":     memberRole,
+			"joinedAt": joinedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve organization"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        orgID,
+			"name":      name,
+			"role":      role,
+			"catCount":  catCount,
+			"members":   members,
+			"createdAt": createdAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// GetOrganizationCats lists the cats of the organization, hidden cats included
+func GetOrganizationCats(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, offset, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	orgID := c.Param("id")
+	if _, ok := getOrganizationRole(c, DB, orgID, userID); !ok {
+		return
+	}
+
+	rows, err := DB.Query(`SELECT id, name, race, sex, age_in_month, description, image_urls, has_matched, user_id, hidden_at IS NOT NULL, created_at
+		FROM cats WHERE organization_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC LIMIT $2 OFFSET $3`, orgID, limit, offset)
+	if err != nil {
+		log.Println("Error retrieving organization cats:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cats"})
+		return
+	}
+	defer rows.Close()
+
+	cats := []gin.H{}
+	for rows.Next() {
+		var cat struct {
+			ID          int
+			Name        string
+			Race        string
+			Sex         string
+			AgeInMonth  int
+			Description string
+			ImageURLs   []string
+			HasMatched  bool
+			ContactID   int
+			Hidden      bool
+			CreatedAt   time.Time
+		}
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Race, &cat.Sex, &cat.AgeInMonth, &cat.Description, pq.Array(&cat.ImageURLs),
+			&cat.HasMatched, &cat.ContactID, &cat.Hidden, &cat.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cats"})
+			return
+		}
+		cats = append(cats, gin.H{
+			"id":          strconv.Itoa(cat.ID),
+			"name":        cat.Name,
+			"race":        cat.Race,
+			"sex":         cat.Sex,
+			"ageInMonth":  cat.AgeInMonth,
+			"description": cat.Description,
+			"imageUrls":   cat.ImageURLs,
+			"hasMatched":  cat.HasMatched,
+			"contactId":   strconv.Itoa(cat.ContactID),
+			"hidden":      cat.Hidden,
+			"createdAt":   cat.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve cats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": cats})
+}
+
+// InviteOrganizationMember mails an invitation link to the email address,
+// managers can invite managers and viewers, owners can also invite owners
+func InviteOrganizationMember(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role" binding:"required,oneof=owner manager viewer"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	orgID := c.Param("id")
+	role, ok := getOrganizationRole(c, DB, orgID, userID)
+	if !ok {
+		return
+	}
+	if role == "viewer" || (request.Role == "owner" && role != "owner") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to invite members with this role"})
+		return
+	}
+
+	var isMember bool
+	err = DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM organization_members m JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = $1 AND LOWER(u.email) = LOWER($2))`, orgID, request.Email).Scan(&isMember)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member"})
+		return
+	}
+
+	token, err := generateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	var invitationID int
+	var expiresAt time.Time
+	err = DB.QueryRow("INSERT INTO organization_invitations (organization_id, email, role, token_hash, invited_by, expires_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, expires_at",
+		orgID, request.Email, request.Role, hashToken(token), userID, time.Now().Add(invitationTTL)).Scan(&invitationID, &expiresAt)
+	if err != nil {
+		log.Println("Error creating invitation:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation"})
+		return
+	}
+
+	var orgName, inviterName, locale string
+	err = DB.QueryRow("SELECT o.name, u.name, u.locale FROM organizations o, users u WHERE o.id = $1 AND u.id = $2", orgID, userID).Scan(&orgName, &inviterName, &locale)
+	if err != nil {
+		log.Println("Error retrieving invitation details:", err)
+	} else {
+		mailer.Send(request.Email, locale, mailer.OrgInvitation, gin.H{
+			"InviterName":      inviterName,
+			"OrganizationName": orgName,
+			"Role":             request.Role,
+			"InviteURL":        appURL("/organization-invitation", url.Values{"token": {token}}),
+		})
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        strconv.Itoa(invitationID),
+			"email":     request.Email,
+			"role":      request.Role,
+			"expiresAt": expiresAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// AcceptOrganizationInvitation adds the user to the organization, the
+// invitation must have been sent to the email address of the user
+func AcceptOrganizationInvitation(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	defer tx.Rollback()
+
+	var invitationID, orgID int
+	var role string
+	err = tx.QueryRow(`SELECT i.id, i.organization_id, i.role FROM organization_invitations i, users u
+		WHERE i.token_hash = $1 AND i.accepted_at IS NULL AND i.expires_at > NOW() AND u.id = $2 AND LOWER(u.email) = LOWER(i.email)
+		FOR UPDATE OF i`, hashToken(request.Token), userID).Scan(&invitationID, &orgID, &role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired invitation"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", orgID, userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You are already a member"})
+		return
+	}
+	_, err = tx.Exec("UPDATE organization_invitations SET accepted_at = NOW() WHERE id = $1", invitationID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error accepting invitation:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{"organizationId": strconv.Itoa(orgID), "role": role}})
+}
+
+// countOwners counts the owners of the organization while locking them, so
+// the last owner cannot be demoted or removed concurrently
+func countOwners(tx *sql.Tx, orgID string) (int, error) {
+	owners, err := queryInts(tx, "SELECT user_id FROM organization_members WHERE organization_id = $1 AND role = 'owner' FOR UPDATE", orgID)
+	return len(owners), err
+}
+
+// leaveOrganizations removes the user from their organizations before their
+// account is deleted or erased. The organization cats the user is the contact
+// of are handed over to another owner. It reports false, leaving everything
+// untouched, when the user is the last owner of an organization.
+func leaveOrganizations(tx *sql.Tx, userID int) (bool, error) {
+	// The owners are locked so two owners cannot leave concurrently
+	_, err := queryInts(tx, `SELECT user_id FROM organization_members WHERE role = 'owner'
+		AND organization_id IN (SELECT organization_id FROM organization_members WHERE user_id = $1) FOR UPDATE`, userID)
+	if err != nil {
+		return false, err
+	}
+
+	var lastOwner bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM organization_members m WHERE m.user_id = $1 AND m.role = 'owner'
+		AND NOT EXISTS(SELECT 1 FROM organization_members o WHERE o.organization_id = m.organization_id AND o.role = 'owner' AND o.user_id != $1))`,
+		userID).Scan(&lastOwner)
+	if err != nil || lastOwner {
+		return false, err
+	}
+
+	_, err = tx.Exec(`UPDATE cats SET user_id = owners.user_id
+		FROM (SELECT DISTINCT ON (organization_id) organization_id, user_id FROM organization_members
+			WHERE role = 'owner' AND user_id != $1 ORDER BY organization_id, created_at) owners
+		WHERE cats.organization_id = owners.organization_id AND cats.user_id = $1`, userID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM organization_members WHERE user_id = $1", userID)
+	}
+	return err == nil, err
+}
+
+func queryInts(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []int
+	for rows.Next() {
+		var value int
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// UpdateOrganizationMemberRole changes the role of a member, owners only
+func UpdateOrganizationMemberRole(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Role string `json:"role" binding:"required,oneof=owner manager viewer"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	orgID := c.Param("id")
+	role, ok := getOrganizationRole(c, DB, orgID, userID)
+	if !ok {
+		return
+	}
+	if role != "owner" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can change member roles"})
+		return
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member role"})
+		return
+	}
+	defer tx.Rollback()
+
+	owners, err := countOwners(tx, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member role"})
+		return
+	}
+
+	var currentRole string
+	err = tx.QueryRow("SELECT role FROM organization_members WHERE organization_id = $1 AND user_id = $2 FOR UPDATE", orgID, c.Param("userId")).Scan(&currentRole)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if currentRole == "owner" && request.Role != "owner" && owners == 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An organization needs at least one owner"})
+		return
+	}
+
+	_, err = tx.Exec("UPDATE organization_members SET role = $1 WHERE organization_id = $2 AND user_id = $3", request.Role, orgID, c.Param("userId"))
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error updating member role:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update member role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member role updated successfully"})
+}
+
+// RemoveOrganizationMember removes a member, owners can remove anyone and
+// members can leave. The cats the member was the contact of are handed over
+// to an owner.
+func RemoveOrganizationMember(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	memberID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	orgID := c.Param("id")
+	role, ok := getOrganizationRole(c, DB, orgID, userID)
+	if !ok {
+		return
+	}
+	if role != "owner" && memberID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only owners can remove other members"})
+		return
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	defer tx.Rollback()
+
+	owners, err := queryInts(tx, "SELECT user_id FROM organization_members WHERE organization_id = $1 AND role = 'owner' ORDER BY created_at FOR UPDATE", orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	var contactID int
+	for _, ownerID := range owners {
+		if ownerID != memberID {
+			contactID = ownerID
+			break
+		}
+	}
+	if contactID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An organization needs at least one owner"})
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM organization_members WHERE organization_id = $1 AND user_id = $2", orgID, memberID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Member not found"})
+		return
+	}
+	_, err = tx.Exec("UPDATE cats SET user_id = $1 WHERE organization_id = $2 AND user_id = $3", contactID, orgID, memberID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error removing member:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// TransferCat moves a cat between its owner and an organization. A cat the
+// user manages can be moved to an organization they manage, and a manager
+// can hand an organization cat over to a member as their own cat.
+func TransferCat(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		OrganizationID string `json:"organizationId" binding:"required_without=UserID,excluded_with=UserID"`
+		UserID         string `json:"userId" binding:"required_without=OrganizationID"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	// Match requests point at the users of the cat, so cats in a match stay put
+	var exists bool
+	err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM match_cats WHERE (issuedCatId=$1 OR receiverCatId=$1) AND deleted_at IS NULL)", catID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cat cannot be transferred because it is involved in matches"})
+		return
+	}
+
+	var orgID sql.NullInt64
+	if err := DB.QueryRow("SELECT organization_id FROM cats WHERE id = $1", catID).Scan(&orgID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The new contact and organization of the cat
+	var newUserID int
+	var newOrgID interface{}
+	if request.OrganizationID != "" {
+		role, ok := getOrganizationRole(c, DB, request.OrganizationID, userID)
+		if !ok {
+			return
+		}
+		if role == "viewer" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to add cats to this organization"})
+			return
+		}
+		newUserID, newOrgID = userID, request.OrganizationID
+	} else {
+		if !orgID.Valid {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cat does not belong to an organization"})
+			return
+		}
+		newUserID, err = strconv.Atoi(request.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userId"})
+			return
+		}
+		var isMember bool
+		err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM organization_members WHERE organization_id = $1 AND user_id = $2)", orgID.Int64, newUserID).Scan(&isMember)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !isMember {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cats can only be transferred to members of the organization"})
+			return
+		}
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer cat"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE cats SET user_id = $1, organization_id = $2 WHERE id = $3", newUserID, newOrgID, catID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error transferring cat:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer cat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cat transferred successfully",
+		"data": gin.H{
+			"id":             catID,
+			"userId":         strconv.Itoa(newUserID),
+			"organizationId": newOrgID,
+		},
+	})
+}
@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/mailer"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	// Only one reset mail is sent per interval, further requests are ignored
+	passwordResetInterval = time.Minute
+)
+
+// forgotPasswordResponse is the same whether the email exists or not
+var forgotPasswordResponse = gin.H{"message": "If the email is registered, a password reset link has been sent"}
+
+func ForgotPassword(c *gin.Context) {
+	var request struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var userID int
+	var name, locale string
+	err = DB.QueryRow("SELECT id, name, locale FROM users WHERE email = $1 AND deleted_at IS NULL", request.Email).Scan(&userID, &name, &locale)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusOK, forgotPasswordResponse)
+		return
+	} else if err != nil {
+		log.Println("Error retrieving user:", err)
+		c.JSON(http.StatusOK, forgotPasswordResponse)
+		return
+	}
+
+	var recentlySent bool
+	err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM password_resets WHERE user_id = $1 AND created_at > NOW() - $2 * INTERVAL '1 second')",
+		userID, int(passwordResetInterval.Seconds())).Scan(&recentlySent)
+	if err != nil || recentlySent {
+		c.JSON(http.StatusOK, forgotPasswordResponse)
+		return
+	}
+
+	token, err := generateSecret()
+	if err == nil {
+		_, err = DB.Exec("INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+			userID, hashToken(token), time.Now().Add(passwordResetTTL))
+	}
+	if err != nil {
+		log.Println("Error creating password reset:", err)
+		c.JSON(http.StatusOK, forgotPasswordResponse)
+		return
+	}
+
+	mailer.Send(request.Email, locale, mailer.ResetPassword, gin.H{
+		"Name":     name,
+		"ResetURL": appURL("/reset-password", url.Values{"token": {token}}),
+	})
+
+	c.JSON(http.StatusOK, forgotPasswordResponse)
+}
+
+func ResetPassword(c *gin.Context) {
+	var request struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=5,max=15"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Consume the reset token, it can only be used once
+	var userID int
+	err = tx.QueryRow("UPDATE password_resets SET used_at = NOW() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() RETURNING user_id",
+		hashToken(request.Token)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	// Setting token_expired_at revokes every access token issued before now
+	_, err = tx.Exec("UPDATE users SET password = $1, token_expired_at = NOW(), updated_at = NOW() WHERE id = $2 AND deleted_at IS NULL", string(hashedPassword), userID)
+	if err == nil {
+		_, err = tx.Exec("UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully, please log in again"})
+}
@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPedigreeGenerations = 3
+	maxPedigreeGenerations     = 10
+	// Depth used when looking for common ancestors of a prospective pairing
+	inbreedingGenerations      = 6
+	defaultInbreedingThreshold = 0.0625
+)
+
+type pedigreeCat struct {
+	ID         int
+	Name       string
+	Race       string
+	Sex        string
+	AgeInMonth int
+	SireID     sql.NullInt64
+	DamID      sql.NullInt64
+}
+
+type pedigree map[int]pedigreeCat
+
+// inbreedingThreshold reads INBREEDING_THRESHOLD, the highest coefficient of
+// inbreeding allowed for a new match request
+func inbreedingThreshold() float64 {
+	threshold, err := strconv.ParseFloat(os.Getenv("INBREEDING_THRESHOLD"), 64)
+	if err != nil || threshold < 0 {
+		return defaultInbreedingThreshold
+	}
+	return threshold
+}
+
+// loadPedigree fetches the given cats and their ancestors up to the given number of generations
+func loadPedigree(DB *sql.DB, generations int, catIDs ...int) (pedigree, error) {
+	rows, err := DB.Query(`WITH RECURSIVE ancestors (id, depth) AS (
+			SELECT id, 0 FROM cats WHERE id = ANY($1)
+			UNION
+			SELECT p.id, a.depth + 1 FROM ancestors a
+			INNER JOIN cats c ON c.id = a.id
+			INNER JOIN cats p ON p.id = c.sire_id OR p.id = c.dam_id
+			WHERE a.depth < $2
+		)
+		SELECT id, name, race, sex, age_in_month, sire_id, dam_id FROM cats WHERE id IN (SELECT id FROM ancestors)`,
+		pq.Array(catIDs), generations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	p := pedigree{}
+	for rows.Next() {
+		var cat pedigreeCat
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Race, &cat.Sex, &cat.AgeInMonth, &cat.SireID, &cat.DamID); err != nil {
+			return nil, err
+		}
+		p[cat.ID] = cat
+	}
+	return p, rows.Err()
+}
+
+func (p pedigree) parents(id int) (int, int) {
+	cat, ok := p[id]
+	if !ok {
+		return 0, 0
+	}
+	return int(cat.SireID.Int64), int(cat.DamID.Int64)
+}
+
+// isAncestor reports whether ancestor appears in the pedigree of id
+func (p pedigree) isAncestor(ancestor, id int, depth int) bool {
+	if depth > maxPedigreeGenerations {
+		return false
+	}
+	sire, dam := p.parents(id)
+	for _, parent := range []int{sire, dam} {
+		if parent == 0 {
+			continue
+		}
+		if parent == ancestor || p.isAncestor(ancestor, parent, depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// kinship computes the coefficient of coancestry between a and b using the
+// recursive tabular method. The coefficient of inbreeding of their offspring
+// equals their coancestry.
+func (p pedigree) kinship(a, b int, depth int) float64 {
+	if a == 0 || b == 0 || depth > 2*maxPedigreeGenerations {
+		return 0
+	}
+	if a == b {
+		sire, dam := p.parents(a)
+		return 0.5 * (1 + p.kinship(sire, dam, depth+1))
+	}
+	// Always expand the younger cat so ancestors are visited before their descendants
+	if p.isAncestor(b, a, 0) {
+		a, b = b, a
+	}
+	sire, dam := p.parents(b)
+	return 0.5 * (p.kinship(a, sire, depth+1) + p.kinship(a, dam, depth+1))
+}
+
+// closeRelation returns the relationship between two cats when they are
+// parent and offspring or (half) siblings, otherwise an empty string
+func (p pedigree) closeRelation(a, b int) string {
+	aSire, aDam := p.parents(a)
+	bSire, bDam := p.parents(b)
+	if aSire == b || aDam == b || bSire == a || bDam == a {
+		return "parent and offspring"
+	}
+	sameSire := aSire != 0 && aSire == bSire
+	sameDam := aDam != 0 && aDam == bDam
+	if sameSire && sameDam {
+		return "full siblings"
+	}
+	if sameSire || sameDam {
+		return "half siblings"
+	}
+	return ""
+}
+
+func (p pedigree) tree(id int, generations int) interface{} {
+	cat, ok := p[id]
+	if !ok {
+		return nil
+	}
+	node := gin.H{
+		"id":         strconv.Itoa(cat.ID),
+		"name":       cat.Name,
+		"race":       cat.Race,
+		"sex":        cat.Sex,
+		"ageInMonth": cat.AgeInMonth,
+		"sire":       nil,
+		"dam":        nil,
+	}
+	if generations > 0 {
+		sire, dam := p.parents(id)
+		if sire != 0 {
+			node["sire"] = p.tree(sire, generations-1)
+		}
+		if dam != 0 {
+			node["dam"] = p.tree(dam, generations-1)
+		}
+	}
+	return node
+}
+
+// checkInbreeding loads the pedigree of both cats and returns the coefficient
+// of inbreeding of their offspring and a reason when the pairing must be refused
+func checkInbreeding(DB *sql.DB, catID, mateID int) (float64, string, error) {
+	p, err := loadPedigree(DB, inbreedingGenerations, catID, mateID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if relation := p.closeRelation(catID, mateID); relation != "" {
+		return p.kinship(catID, mateID, 0), "Cats are " + relation, nil
+	}
+
+	coefficient := p.kinship(catID, mateID, 0)
+	if threshold := inbreedingThreshold(); coefficient > threshold {
+		return coefficient, fmt.Sprintf("Coefficient of inbreeding %.4f exceeds the allowed %.4f", coefficient, threshold), nil
+	}
+	return coefficient, "", nil
+}
+
+// validateParents checks that the given sire and dam exist with the proper sex
+// and that they do not create a loop in the pedigree of catID (0 for a new cat)
+func validateParents(DB *sql.DB, catID int, sireID, damID string) (string, error) {
+	parents := []struct {
+		id   string
+		role string
+		sex  string
+	}{
+		{sireID, "Sire", "male"},
+		{damID, "Dam", "female"},
+	}
+
+	for _, parent := range parents {
+		if parent.id == "" {
+			continue
+		}
+		parentID, err := strconv.Atoi(parent.id)
+		if err != nil {
+			return "Invalid " + parent.role + " id", nil
+		}
+		if parentID == catID {
+			return parent.role + " cannot be the cat itself", nil
+		}
+
+		var sex string
+		err = DB.QueryRow("SELECT sex FROM cats WHERE id = $1 AND deleted_at IS NULL", parentID).Scan(&sex)
+		if err == sql.ErrNoRows {
+			return parent.role + " not found", nil
+		} else if err != nil {
+			return "", err
+		}
+		if sex != parent.sex {
+			return parent.role + " must be " + parent.sex, nil
+		}
+
+		if catID != 0 {
+			p, err := loadPedigree(DB, maxPedigreeGenerations, parentID)
+			if err != nil {
+				return "", err
+			}
+			if p.isAncestor(catID, parentID, 0) {
+				return parent.role + " cannot be a descendant of the cat", nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// nullIfEmpty stores an omitted optional id as NULL instead of an empty string
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func GetPedigree(c *gin.Context) {
+	if err := configurations.CheckBearerToken(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	catID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	generations, err := strconv.Atoi(c.DefaultQuery("generations", strconv.Itoa(defaultPedigreeGenerations)))
+	if err != nil || generations < 1 || generations > maxPedigreeGenerations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid generations, must be between 1 and " + strconv.Itoa(maxPedigreeGenerations)})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var exists bool
+	err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM cats WHERE id = $1 AND deleted_at IS NULL)", catID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return
+	}
+
+	p, err := loadPedigree(DB, generations, catID)
+	if err != nil {
+		log.Println("Error retrieving pedigree:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pedigree"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": p.tree(catID, generations)})
+}
+
+func GetInbreeding(c *gin.Context) {
+	if err := configurations.CheckBearerToken(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	catID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id"})
+		return
+	}
+	mateID, err := strconv.Atoi(c.Query("mateId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mateId"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var found int
+	err = DB.QueryRow("SELECT COUNT(*) FROM cats WHERE id IN ($1, $2) AND deleted_at IS NULL", catID, mateID).Scan(&found)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if found != 2 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cat not found"})
+		return
+	}
+
+	coefficient, reason, err := checkInbreeding(DB, catID, mateID)
+	if err != nil {
+		log.Println("Error computing inbreeding:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute inbreeding"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"catId":       strconv.Itoa(catID),
+			"mateId":      strconv.Itoa(mateID),
+			"coefficient": coefficient,
+			"threshold":   inbreedingThreshold(),
+			"allowed":     reason == "",
+			"reason":      reason,
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+)
+
+// testPedigree builds a pedigree from cat id to its sire and dam, 0 when unknown
+func testPedigree(parents map[int][2]int) pedigree {
+	p := pedigree{}
+	for id, pair := range parents {
+		cat := pedigreeCat{ID: id}
+		if pair[0] != 0 {
+			cat.SireID = sql.NullInt64{Int64: int64(pair[0]), Valid: true}
+		}
+		if pair[1] != 0 {
+			cat.DamID = sql.NullInt64{Int64: int64(pair[1]), Valid: true}
+		}
+		p[id] = cat
+	}
+	return p
+}
+
+func TestKinship(t *testing.T) {
+	// 1 and 2 are founders, 3 and 4 their full siblings, 5 a founder mated
+	// with 3 for 6, 7 a founder mated with 4 for 8 (6 and 8 first cousins),
+	// 9 the offspring of the full siblings 3 and 4, 10 of 3 and its daughter 6
+	p := testPedigree(map[int][2]int{
+		1: {}, 2: {}, 5: {}, 7: {}, 11: {}, 12: {},
+		3:  {1, 2},
+		4:  {1, 2},
+		6:  {3, 5},
+		8:  {7, 4},
+		9:  {3, 4},
+		10: {3, 6},
+		13: {1, 11},
+		14: {12, 9},
+		15: {12, 9},
+	})
+
+	tests := []struct {
+		name string
+		a, b int
+		want float64
+	}{
+		{"unrelated founders", 1, 2, 0},
+		{"unknown cat", 1, 99, 0},
+		{"founder with itself", 1, 1, 0.5},
+		{"parent and offspring", 1, 3, 0.25},
+		{"offspring and parent", 3, 1, 0.25},
+		{"full siblings", 3, 4, 0.25},
+		{"half siblings", 3, 13, 0.125},
+		{"uncle and niece", 4, 6, 0.125},
+		{"first cousins", 6, 8, 0.0625},
+		{"grandparent", 1, 6, 0.125},
+		{"inbred cat with itself", 9, 9, 0.625},
+		{"parent and inbred offspring", 3, 9, 0.375},
+		{"full siblings with an inbred parent", 14, 15, 0.25 * (0.5 + 0.625)},
+		{"sire and daughter mated again", 3, 10, 0.5 * (0.5 + 0.25)},
+	}
+	for _, tt := range tests {
+		if got := p.kinship(tt.a, tt.b, 0); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: kinship(%d, %d) = %v, want %v", tt.name, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestKinshipLoop(t *testing.T) {
+	// validateParents refuses loops, kinship must still terminate on one
+	p := testPedigree(map[int][2]int{1: {2, 0}, 2: {1, 0}})
+	if got := p.kinship(1, 2, 0); math.IsNaN(got) || got < 0 || got > 1 {
+		t.Errorf("kinship() of a loop = %v", got)
+	}
+}
+
+func TestCloseRelation(t *testing.T) {
+	p := testPedigree(map[int][2]int{
+		1: {}, 2: {}, 5: {},
+		3: {1, 2},
+		4: {1, 2},
+		6: {1, 5},
+		7: {3, 5},
+	})
+	tests := []struct {
+		a, b int
+		want string
+	}{
+		{1, 3, "parent and offspring"},
+		{3, 1, "parent and offspring"},
+		{3, 4, "full siblings"},
+		{3, 6, "half siblings"},
+		{1, 2, ""},
+		{4, 7, ""},
+	}
+	for _, tt := range tests {
+		if got := p.closeRelation(tt.a, tt.b); got != tt.want {
+			t.Errorf("closeRelation(%d, %d) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+type preferenceRequest struct {
+	AcceptedRaces    []string `json:"acceptedRaces" binding:"omitempty,dive,min=1,max=50"`
+	MinAgeInMonth    int      `json:"minAgeInMonth" binding:"omitempty,min=1,max=120082"`
+	MaxAgeInMonth    int      `json:"maxAgeInMonth" binding:"omitempty,min=1,max=120082"`
+	MaxDistanceKm    int      `json:"maxDistanceKm" binding:"omitempty,min=1,max=20000"`
+	AcceptCrossBreed *bool    `json:"acceptCrossBreed"`
+}
+
+type catPreference struct {
+	AcceptedRaces    []string
+	MinAgeInMonth    sql.NullInt64
+	MaxAgeInMonth    sql.NullInt64
+	MaxDistanceKm    sql.NullInt64
+	AcceptCrossBreed bool
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// nullIfZero stores an omitted optional number as NULL instead of 0
+func nullIfZero(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+func nullInt64Value(n sql.NullInt64) interface{} {
+	if !n.Valid {
+		return nil
+	}
+	return n.Int64
+}
+
+func getCatPreference(DB *sql.DB, catID string) (catPreference, error) {
+	var pref catPreference
+	err := DB.QueryRow("SELECT accepted_races, min_age_in_month, max_age_in_month, max_distance_km, accept_cross_breed, created_at, updated_at FROM cat_preferences WHERE cat_id = $1", catID).
+		Scan(pq.Array(&pref.AcceptedRaces), &pref.MinAgeInMonth, &pref.MaxAgeInMonth, &pref.MaxDistanceKm, &pref.AcceptCrossBreed, &pref.CreatedAt, &pref.UpdatedAt)
+	return pref, err
+}
+
+func preferenceResponse(catID string, pref catPreference) gin.H {
+	acceptedRaces := pref.AcceptedRaces
+	if acceptedRaces == nil {
+		acceptedRaces = []string{}
+	}
+	return gin.H{
+		"catId":            catID,
+		"acceptedRaces":    acceptedRaces,
+		"minAgeInMonth":    nullInt64Value(pref.MinAgeInMonth),
+		"maxAgeInMonth":    nullInt64Value(pref.MaxAgeInMonth),
+		"maxDistanceKm":    nullInt64Value(pref.MaxDistanceKm),
+		"acceptCrossBreed": pref.AcceptCrossBreed,
+		"createdAt":        pref.CreatedAt.Format(time.RFC3339),
+		"updatedAt":        pref.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+func bindPreference(c *gin.Context, DB *sql.DB) (preferenceRequest, bool) {
+	var pref preferenceRequest
+	if err := c.ShouldBindJSON(&pref); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return pref, false
+	}
+	if pref.MinAgeInMonth != 0 && pref.MaxAgeInMonth != 0 && pref.MinAgeInMonth > pref.MaxAgeInMonth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "minAgeInMonth cannot be greater than maxAgeInMonth"})
+		return pref, false
+	}
+	if pref.AcceptedRaces == nil {
+		pref.AcceptedRaces = []string{}
+	}
+	for i, race := range pref.AcceptedRaces {
+		breed, err := resolveBreed(DB, race)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return pref, false
+		}
+		if breed == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid race " + race})
+			return pref, false
+		}
+		pref.AcceptedRaces[i] = breed
+	}
+	if pref.AcceptCrossBreed == nil {
+		acceptCrossBreed := true
+		pref.AcceptCrossBreed = &acceptCrossBreed
+	}
+	return pref, true
+}
+
+func CreatePreference(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	pref, ok := bindPreference(c, DB)
+	if !ok {
+		return
+	}
+
+	var exists bool
+	err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM cat_preferences WHERE cat_id = $1)", catID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "Preference for this cat already exists"})
+		return
+	}
+
+	_, err = DB.Exec("INSERT INTO cat_preferences (cat_id, accepted_races, min_age_in_month, max_age_in_month, max_distance_km, accept_cross_breed) VALUES ($1, $2, $3, $4, $5, $6)",
+		catID, pq.Array(pref.AcceptedRaces), nullIfZero(pref.MinAgeInMonth), nullIfZero(pref.MaxAgeInMonth), nullIfZero(pref.MaxDistanceKm), *pref.AcceptCrossBreed)
+	if err != nil {
+		log.Println("Error adding preference:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add preference"})
+		return
+	}
+
+	saved, err := getCatPreference(DB, catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preference"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "success", "data": preferenceResponse(catID, saved)})
+}
+
+func GetPreference(c *gin.Context) {
+	if err := configurations.CheckBearerToken(c); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	pref, err := getCatPreference(DB, catID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preference not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preference"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": preferenceResponse(catID, pref)})
+}
+
+func UpdatePreference(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	pref, ok := bindPreference(c, DB)
+	if !ok {
+		return
+	}
+
+	result, err := DB.Exec("UPDATE cat_preferences SET accepted_races = $1, min_age_in_month = $2, max_age_in_month = $3, max_distance_km = $4, accept_cross_breed = $5, updated_at = NOW() WHERE cat_id = $6",
+		pq.Array(pref.AcceptedRaces), nullIfZero(pref.MinAgeInMonth), nullIfZero(pref.MaxAgeInMonth), nullIfZero(pref.MaxDistanceKm), *pref.AcceptCrossBreed, catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preference"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preference not found"})
+		return
+	}
+
+	saved, err := getCatPreference(DB, catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preference"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": preferenceResponse(catID, saved)})
+}
+
+func DeletePreference(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	catID := c.Param("id")
+	if !checkCatOwner(c, DB, catID, userID) {
+		return
+	}
+
+	result, err := DB.Exec("DELETE FROM cat_preferences WHERE cat_id = $1", catID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete preference"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Preference not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Preference deleted successfully"})
+}
+
+// checkMatchPreference validates the issuer cat against the preference of the
+// receiver cat. It returns a non-empty reason when the request must be refused.
+func checkMatchPreference(DB *sql.DB, matchCatID, userCatID string) (string, error) {
+	pref, err := getCatPreference(DB, matchCatID)
+	if err == sql.ErrNoRows {
+		// No preference means the owner accepts every request
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	var userCatRace, matchCatRace string
+	var userCatAge, userCatOwnerID, matchCatOwnerID int
+	err = DB.QueryRow("SELECT race, age_in_month, user_id FROM cats WHERE id = $1", userCatID).Scan(&userCatRace, &userCatAge, &userCatOwnerID)
+	if err != nil {
+		return "", err
+	}
+	err = DB.QueryRow("SELECT race, user_id FROM cats WHERE id = $1", matchCatID).Scan(&matchCatRace, &matchCatOwnerID)
+	if err != nil {
+		return "", err
+	}
+
+	if len(pref.AcceptedRaces) > 0 {
+		accepted := false
+		for _, r := range pref.AcceptedRaces {
+			if r == userCatRace {
+				accepted = true
+				break
+			}
+		}
+		if !accepted {
+			return fmt.Sprintf("Match cat owner does not accept %s cats", userCatRace), nil
+		}
+	}
+	if !pref.AcceptCrossBreed && userCatRace != matchCatRace {
+		return "Match cat owner does not accept cross-breed requests", nil
+	}
+	if pref.MinAgeInMonth.Valid && int64(userCatAge) < pref.MinAgeInMonth.Int64 {
+		return "User cat is younger than " + strconv.FormatInt(pref.MinAgeInMonth.Int64, 10) + " months accepted by match cat owner", nil
+	}
+	if pref.MaxAgeInMonth.Valid && int64(userCatAge) > pref.MaxAgeInMonth.Int64 {
+		return "User cat is older than " + strconv.FormatInt(pref.MaxAgeInMonth.Int64, 10) + " months accepted by match cat owner", nil
+	}
+	if pref.MaxDistanceKm.Valid {
+		receiverLat, receiverLon, ok, err := getUserLocation(DB, matchCatOwnerID)
+		if err != nil {
+			return "", err
+		}
+		// Distance can only be enforced once the receiver has set a location
+		if ok {
+			issuerLat, issuerLon, ok, err := getUserLocation(DB, userCatOwnerID)
+			if err != nil {
+				return "", err
+			}
+			if !ok {
+				return "Match cat owner only accepts nearby cats, please set your location first", nil
+			}
+			if haversineKm(issuerLat, issuerLon, receiverLat, receiverLon) > float64(pref.MaxDistanceKm.Int64) {
+				return "User cat is farther than " + strconv.FormatInt(pref.MaxDistanceKm.Int64, 10) + " km accepted by match cat owner", nil
+			}
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"CatsSocial/maintenance"
+	"CatsSocial/privacy"
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const dataExportPurpose = "data_export"
+
+// NotifyDataExportReady tells the user their archive can be downloaded, it
+// is called by the exporter
+func NotifyDataExportReady(DB *sql.DB, userID, exportID int) {
+	notifyUser(DB, userID, events.DataExportReady, gin.H{"exportId": strconv.Itoa(exportID)})
+}
+
+// dataExportResponse describes an export, with a download link while it is ready
+func dataExportResponse(userID, exportID int, status string, createdAt time.Time, completedAt, expiresAt sql.NullTime) (gin.H, error) {
+	response := gin.H{
+		"id":          strconv.Itoa(exportID),
+		"status":      status,
+		"createdAt":   createdAt.Format(time.RFC3339),
+		"completedAt": formatNullTime(completedAt),
+		"expiresAt":   formatNullTime(expiresAt),
+		"downloadUrl": nil,
+	}
+	if status == "ready" && expiresAt.Valid {
+		token, err := configurations.GeneratePurposeToken(userID, dataExportPurpose, strconv.Itoa(exportID), time.Until(expiresAt.Time))
+		if err != nil {
+			return nil, err
+		}
+		response["downloadUrl"] = appURL("/v1/user/me/exports/"+strconv.Itoa(exportID)+"/download", url.Values{"token": {token}})
+	}
+	return response, nil
+}
+
+// RequestDataExport queues an archive of the personal data of the user, an
+// export already in progress is returned instead of queueing another one
+func RequestDataExport(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var exportID int
+	var status string
+	var createdAt time.Time
+	err = DB.QueryRow("SELECT id, status, created_at FROM data_exports WHERE user_id = $1 AND status IN ('pending', 'processing') ORDER BY id DESC LIMIT 1", userID).
+		Scan(&exportID, &status, &createdAt)
+	if err == sql.ErrNoRows {
+		err = DB.QueryRow("INSERT INTO data_exports (user_id) VALUES ($1) RETURNING id, status, created_at", userID).Scan(&exportID, &status, &createdAt)
+	}
+	if err != nil {
+		log.Println("Error requesting data export:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export"})
+		return
+	}
+
+	response, _ := dataExportResponse(userID, exportID, status, createdAt, sql.NullTime{}, sql.NullTime{})
+	c.JSON(http.StatusAccepted, gin.H{"message": "success", "data": response})
+}
+
+func GetDataExport(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var exportID int
+	var status string
+	var createdAt time.Time
+	var completedAt, expiresAt sql.NullTime
+	err = DB.QueryRow("SELECT id, status, created_at, completed_at, expires_at FROM data_exports WHERE id = $1 AND user_id = $2", c.Param("id"), userID).
+		Scan(&exportID, &status, &createdAt, &completedAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data export not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := dataExportResponse(userID, exportID, status, createdAt, completedAt, expiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create download link"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": response})
+}
+
+// DownloadDataExport serves the archive to the holder of the download link,
+// no bearer token is needed so the link can be opened in a browser
+func DownloadDataExport(c *gin.Context) {
+	userID, jti, err := configurations.ParsePurposeToken(c.Query("token"), dataExportPurpose)
+	if err != nil || jti != c.Param("id") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired download link"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var path string
+	err = DB.QueryRow("SELECT file_path FROM data_exports WHERE id = $1 AND user_id = $2 AND status = 'ready' AND expires_at > NOW()", jti, userID).Scan(&path)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Data export not found or expired"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.FileAttachment(path, "catssocial-data-"+jti+".zip")
+}
+
+// EraseAccount forgets the user. Personal data is deleted, while the rows
+// other users still see, their matches and conversations, are kept with the
+// user, their cats and their messages anonymized.
+func EraseAccount(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var email, storedPassword string
+	var avatarURL sql.NullString
+	err = DB.QueryRow("SELECT email, password, avatar_url FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&email, &storedPassword, &avatarURL)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(request.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase account"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Organization cats are handed over to another owner of the organization
+	left, err := leaveOrganizations(tx, userID)
+	if err != nil {
+		log.Println("Error leaving organizations:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase account"})
+		return
+	}
+	if !left {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are the last owner of an organization, make another member owner first"})
+		return
+	}
+
+	var images, exportFiles []string
+	var withdrawnCatIDs []int
+
+	// Pending requests are withdrawn, the match requests and messages of the
+	// user are blanked in the history of the other users
+	withdrawnCatIDs, err = scanCatIDs(tx.Query(`UPDATE match_cats SET deleted_at = NOW() WHERE (issuedId = $1 OR receiverId = $1) AND status = false AND deleted_at IS NULL
+		RETURNING issuedCatId, receiverCatId`, userID))
+	if err == nil {
+		_, err = tx.Exec("UPDATE match_cats SET message = '' WHERE issuedId = $1", userID)
+	}
+	if err == nil {
+		_, err = tx.Exec("UPDATE match_messages SET body = '[deleted]' WHERE sender_id = $1", userID)
+	}
+
+	// Health records go first, deleting the cats would cascade to them and
+	// lose the attachments to remove from storage
+	if err == nil {
+		var attachments []string
+		attachments, err = scanStrings(tx.Query(`WITH deleted AS (DELETE FROM health_records WHERE cat_id IN (SELECT id FROM cats WHERE user_id = $1)
+			RETURNING attachment_url) SELECT attachment_url FROM deleted WHERE attachment_url IS NOT NULL`, userID))
+		images = append(images, attachments...)
+	}
+
+	// Cats without matches are deleted, cats in a match are kept anonymized
+	// so the matches of the other users stay consistent
+	if err == nil {
+		images, err = scanImageURLs(tx.Query(`DELETE FROM cats WHERE user_id = $1
+			AND NOT EXISTS(SELECT 1 FROM match_cats WHERE issuedCatId = cats.id OR receiverCatId = cats.id)
+			RETURNING image_urls`, userID))
+	}
+	if err == nil {
+		var kept []string
+		kept, err = scanImageURLs(tx.Query(`UPDATE cats SET name = 'Deleted cat', description = '', image_urls = '{}', sire_id = NULL, dam_id = NULL,
+			deleted_at = COALESCE(cats.deleted_at, NOW())
+			FROM (SELECT id, image_urls FROM cats WHERE user_id = $1 FOR UPDATE) old
+			WHERE cats.id = old.id
+			RETURNING old.image_urls`, userID))
+		images = append(images, kept...)
+	}
+	for _, query := range []string{
+		"DELETE FROM cat_revisions WHERE cat_id IN (SELECT id FROM cats WHERE user_id = $1)",
+		"DELETE FROM cat_preferences WHERE cat_id IN (SELECT id FROM cats WHERE user_id = $1)",
+		"DELETE FROM favorite_cats WHERE user_id = $1 OR cat_id IN (SELECT id FROM cats WHERE user_id = $1)",
+		"DELETE FROM notifications WHERE user_id = $1",
+		"DELETE FROM email_verifications WHERE user_id = $1",
+		"DELETE FROM password_resets WHERE user_id = $1",
+		"DELETE FROM totp_recovery_codes WHERE user_id = $1",
+		"DELETE FROM webhooks WHERE user_id = $1",
+		"DELETE FROM user_blocks WHERE blocker_id = $1 OR blocked_id = $1",
+		"UPDATE organization_invitations SET invited_by = NULL WHERE invited_by = $1",
+		"UPDATE reports SET reporter_id = NULL, details = NULL WHERE reporter_id = $1",
+	} {
+		if err == nil {
+			_, err = tx.Exec(query, userID)
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM failed_logins WHERE user_id = $1 OR LOWER(email) = LOWER($2)", userID, email)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM login_attempts WHERE key = $1", "account:"+strings.ToLower(email))
+	}
+	if err == nil {
+		exportFiles, err = scanStrings(tx.Query("DELETE FROM data_exports WHERE user_id = $1 AND file_path IS NOT NULL RETURNING file_path", userID))
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM data_exports WHERE user_id = $1", userID)
+	}
+
+	// The anonymized user row stays as the counterpart of the kept matches,
+	// token_expired_at signs out every session
+	if err == nil {
+		_, err = tx.Exec(`UPDATE users SET email = 'erased-' || id || '@erased.invalid', name = 'Deleted user', password = '',
+			avatar_url = NULL, city = NULL, latitude = NULL, longitude = NULL, email_verified_at = NULL,
+			totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, suspension_reason = NULL,
+			token_expired_at = NOW(), deleted_at = COALESCE(deleted_at, NOW()), erased_at = NOW(), updated_at = NOW()
+			WHERE id = $1`, userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error erasing account:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase account"})
+		return
+	}
+
+	if avatarURL.Valid {
+		images = append(images, avatarURL.String)
+	}
+	if err := maintenance.DeleteUnreferenced(DB, maintenance.ImageStoreFromEnv(), images); err != nil {
+		log.Println("Error deleting images:", err)
+	}
+	for _, path := range exportFiles {
+		privacy.RemoveArchive(path)
+	}
+	notifyFavoritersIfAvailable(DB, withdrawnCatIDs...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account erased successfully"})
+}
+
+// scanImageURLs reads the image_urls arrays returned by a query into one list
+func scanImageURLs(rows *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var images []string
+		if err := rows.Scan(pq.Array(&images)); err != nil {
+			return nil, err
+		}
+		urls = append(urls, images...)
+	}
+	return urls, rows.Err()
+}
+
+func scanStrings(rows *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,422 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/events"
+	"CatsSocial/mailer"
+	"CatsSocial/maintenance"
+	"bytes"
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// getProfile returns the profile of an active user
+func getProfile(DB *sql.DB, userID int) (gin.H, error) {
+	var profile struct {
+		ID              int
+		Email           string
+		Name            string
+		Locale          string
+		AvatarURL       sql.NullString
+		City            sql.NullString
+		EmailVerifiedAt sql.NullTime
+		CreatedAt       time.Time
+	}
+	err := DB.QueryRow("SELECT id, email, name, locale, avatar_url, city, email_verified_at, created_at FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(
+		&profile.ID, &profile.Email, &profile.Name, &profile.Locale, &profile.AvatarURL, &profile.City, &profile.EmailVerifiedAt, &profile.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"id":            strconv.Itoa(profile.ID),
+		"email":         profile.Email,
+		"name":          profile.Name,
+		"locale":        profile.Locale,
+		"avatarUrl":     profile.AvatarURL.String,
+		"city":          profile.City.String,
+		"emailVerified": profile.EmailVerifiedAt.Valid,
+		"createdAt":     profile.CreatedAt.Format(time.RFC3339),
+	}, nil
+}
+
+func GetProfile(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	profile, err := getProfile(DB, userID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": profile})
+}
+
+func UpdateProfile(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// Only the given fields are updated
+	var request struct {
+		Name   *string `json:"name" binding:"omitempty,min=5,max=50"`
+		Email  *string `json:"email" binding:"omitempty,email"`
+		Locale *string `json:"locale" binding:"omitempty,oneof=id en"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var currentEmail string
+	err = DB.QueryRow("SELECT email FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&currentEmail)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	sets := []string{}
+	args := []interface{}{}
+	addSet := func(column string, value interface{}) {
+		args = append(args, value)
+		sets = append(sets, column+" = $"+strconv.Itoa(len(args)))
+	}
+	if request.Name != nil {
+		addSet("name", *request.Name)
+	}
+	if request.Locale != nil {
+		addSet("locale", *request.Locale)
+	}
+	// A new email address has to be verified again
+	emailChanged := request.Email != nil && !strings.EqualFold(*request.Email, currentEmail)
+	if emailChanged {
+		addSet("email", *request.Email)
+		sets = append(sets, "email_verified_at = NULL")
+	}
+	if len(sets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	args = append(args, userID)
+	_, err = DB.Exec("UPDATE users SET "+strings.Join(sets, ", ")+", updated_at = NOW() WHERE id = $"+strconv.Itoa(len(args)), args...)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email Has been used"})
+		return
+	} else if err != nil {
+		log.Println("Error updating profile:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if emailChanged {
+		link, err := createEmailVerification(DB, userID)
+		if err != nil {
+			log.Println("Error creating email verification:", err)
+		} else {
+			var name, locale string
+			if err := DB.QueryRow("SELECT name, locale FROM users WHERE id = $1", userID).Scan(&name, &locale); err == nil {
+				mailer.Send(*request.Email, locale, mailer.VerifyEmail, gin.H{"Name": name, "VerifyURL": link})
+			}
+		}
+	}
+
+	profile, err := getProfile(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": profile})
+}
+
+func ChangePassword(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		CurrentPassword string `json:"currentPassword" binding:"required"`
+		NewPassword     string `json:"newPassword" binding:"required,min=5,max=15"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var email, storedPassword, role string
+	err = DB.QueryRow("SELECT email, password, role FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&email, &storedPassword, &role)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(request.CurrentPassword)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	// Sign out every other session, the caller gets a fresh token
+	_, err = DB.Exec("UPDATE users SET password = $1, token_expired_at = NOW(), updated_at = NOW() WHERE id = $2", string(hashedPassword), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change password"})
+		return
+	}
+
+	token, err := configurations.GenerateToken(email, userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully", "data": gin.H{"accessToken": token}})
+}
+
+// maxUploadSize is the largest file accepted by saveUpload
+const maxUploadSize = 5 << 20
+
+// imageTypes maps the accepted image content types to their file extension
+var imageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// saveUpload stores the file of the multipart field in the image storage
+// under dir with a random name and returns its URL. The content type is
+// detected from the file itself and has to be one of types.
+func saveUpload(c *gin.Context, field, dir string, types map[string]string) (string, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize+1<<20)
+	header, err := c.FormFile(field)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing " + field + " file"})
+		return "", false
+	}
+	if header.Size > maxUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File is larger than 5 MB"})
+		return "", false
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read " + field + " file"})
+		return "", false
+	}
+	ext, ok := types[http.DetectContentType(head[:n])]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Unsupported " + field + " file type"})
+		return "", false
+	}
+
+	name, err := generateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return "", false
+	}
+	url, err := maintenance.ImageStoreFromEnv().Save(dir+"/"+name+ext, io.MultiReader(bytes.NewReader(head[:n]), file))
+	if err != nil {
+		log.Println("Error storing upload:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store file"})
+		return "", false
+	}
+	return url, true
+}
+
+// UpdateAvatar stores an avatar uploaded as the multipart avatar file in the
+// image storage. A JSON avatarUrl still sets an image hosted elsewhere, an
+// empty one removes the avatar.
+func UpdateAvatar(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var avatarURL string
+	uploaded := c.ContentType() == "multipart/form-data"
+	if uploaded {
+		var ok bool
+		if avatarURL, ok = saveUpload(c, "avatar", "avatars", imageTypes); !ok {
+			return
+		}
+	} else {
+		var request struct {
+			AvatarURL string `json:"avatarUrl" binding:"omitempty,url,max=2000"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		avatarURL = request.AvatarURL
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// The previous avatar is removed from the image storage once replaced
+	var previousURL sql.NullString
+	err = DB.QueryRow(`UPDATE users SET avatar_url = $1, updated_at = NOW()
+		FROM (SELECT id, avatar_url FROM users WHERE id = $2 FOR UPDATE) old
+		WHERE users.id = old.id AND users.deleted_at IS NULL
+		RETURNING old.avatar_url`, nullIfEmpty(avatarURL), userID).Scan(&previousURL)
+	if err != nil && uploaded {
+		maintenance.ImageStoreFromEnv().Delete(avatarURL)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update avatar"})
+		return
+	}
+	if previousURL.Valid && previousURL.String != avatarURL {
+		if err := maintenance.DeleteUnreferenced(DB, maintenance.ImageStoreFromEnv(), []string{previousURL.String}); err != nil {
+			log.Println("Error deleting previous avatar:", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": gin.H{"avatarUrl": avatarURL}})
+}
+
+func DeleteAccount(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var storedPassword string
+	err = DB.QueryRow("SELECT password FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&storedPassword)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(request.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	tx, err := beginCatTx(DB, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	defer tx.Rollback()
+
+	// Organization cats are handed over to another owner of the organization
+	// instead of being deleted with the cats of the user
+	left, err := leaveOrganizations(tx, userID)
+	if err != nil {
+		log.Println("Error leaving organizations:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+	if !left {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are the last owner of an organization, make another member owner first"})
+		return
+	}
+
+	// The account, its cats and its pending match requests are soft deleted,
+	// token_expired_at signs out every session
+	var deletedCatIDs, withdrawnCatIDs []int
+	_, err = tx.Exec("UPDATE users SET deleted_at = NOW(), token_expired_at = NOW(), updated_at = NOW() WHERE id = $1", userID)
+	if err == nil {
+		deletedCatIDs, err = scanCatIDs(tx.Query("UPDATE cats SET deleted_at = NOW() WHERE user_id = $1 AND deleted_at IS NULL RETURNING id", userID))
+	}
+	if err == nil {
+		withdrawnCatIDs, err = scanCatIDs(tx.Query("UPDATE match_cats SET deleted_at = NOW() WHERE (issuedId = $1 OR receiverId = $1) AND status = false AND deleted_at IS NULL RETURNING issuedCatId, receiverCatId", userID))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error deleting account:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+		return
+	}
+
+	for _, catID := range deletedCatIDs {
+		notifyFavoriters(DB, catID, events.FavoriteDeleted)
+	}
+	notifyFavoritersIfAvailable(DB, withdrawnCatIDs...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func uploadContext(t *testing.T, field string, content []byte) (*gin.Context, *httptest.ResponseRecorder) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile(field, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPut, "/v1/user/me/avatar", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	return c, recorder
+}
+
+func TestSaveUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	t.Setenv("IMAGE_STORE_DIR", dir)
+	t.Setenv("IMAGE_BASE_URL", "https://img.example.com")
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	tests := []struct {
+		name    string
+		field   string
+		content []byte
+		status  int
+		ext     string
+	}{
+		{"png", "avatar", png, http.StatusOK, ".png"},
+		{"gif", "avatar", []byte("GIF89a......"), http.StatusOK, ".gif"},
+		{"html", "avatar", []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType, ""},
+		{"missing field", "file", png, http.StatusBadRequest, ""},
+		{"too large", "avatar", append(png, make([]byte, maxUploadSize)...), http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		c, recorder := uploadContext(t, tt.field, tt.content)
+		url, ok := saveUpload(c, "avatar", "avatars", imageTypes)
+		if tt.status == http.StatusOK {
+			if !ok || !strings.HasPrefix(url, "https://img.example.com/avatars/") || !strings.HasSuffix(url, tt.ext) {
+				t.Errorf("%s: saveUpload() = %q, %t, response %s", tt.name, url, ok, recorder.Body)
+				continue
+			}
+			stored, err := os.ReadFile(filepath.Join(dir, strings.TrimPrefix(url, "https://img.example.com/")))
+			if err != nil || !bytes.Equal(stored, tt.content) {
+				t.Errorf("%s: stored file differs from the upload: %v", tt.name, err)
+			}
+		} else if ok || recorder.Code != tt.status {
+			t.Errorf("%s: saveUpload() ok = %t, status %d, want %d", tt.name, ok, recorder.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/security"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	totpIssuer        = "CatsSocial"
+	preAuthPurpose    = "login_2fa"
+	preAuthTTL        = 5 * time.Minute
+	recoveryCodeCount = 10
+	// Wrong codes are counted per user like failed logins
+	maxTwoFactorFailures = 5
+)
+
+// generatePreAuthToken returns the short-lived token of the second login step
+func generatePreAuthToken(userID int) (string, error) {
+	jti, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	return configurations.GeneratePurposeToken(userID, preAuthPurpose, jti, preAuthTTL)
+}
+
+// generateRecoveryCodes replaces the recovery codes of the user and returns
+// them in clear text, only their hashes are stored
+func generateRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	if _, err := tx.Exec("DELETE FROM totp_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		code := secret[:5] + "-" + secret[5:10]
+		if _, err := tx.Exec("INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hashToken(code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode lowercases the code and restores its dash
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if len(code) != 10 {
+		return code
+	}
+	if _, err := hex.DecodeString(code); err != nil {
+		return code
+	}
+	return code[:5] + "-" + code[5:]
+}
+
+// checkSecondFactor accepts a current TOTP code, which can not be used twice,
+// or an unused recovery code, which is consumed
+func checkSecondFactor(DB *sql.DB, userID int, secret, code string) (bool, error) {
+	if step, ok := security.VerifyTOTP(secret, code, time.Now()); ok {
+		result, err := DB.Exec("UPDATE users SET totp_last_step = $1 WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)", step, userID)
+		if err != nil {
+			return false, err
+		}
+		affected, _ := result.RowsAffected()
+		return affected == 1, nil
+	}
+
+	result, err := DB.Exec("UPDATE totp_recovery_codes SET used_at = NOW() WHERE id = (SELECT id FROM totp_recovery_codes WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL LIMIT 1)",
+		userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1, nil
+}
+
+func SetupTwoFactor(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var email string
+	var enabledAt sql.NullTime
+	err = DB.QueryRow("SELECT email, totp_enabled_at FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&email, &enabledAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if enabledAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	// The secret stays pending until a code generated from it is confirmed
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+	_, err = DB.Exec("UPDATE users SET totp_secret = $1, totp_last_step = NULL WHERE id = $2", secret, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set up two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"secret":     secret,
+			"otpauthUri": security.TOTPURI(totpIssuer, email, secret),
+		},
+	})
+}
+
+func ConfirmTwoFactor(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	err = DB.QueryRow("SELECT totp_secret, totp_enabled_at FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&secret, &enabledAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if enabledAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if !secret.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set up two-factor authentication first"})
+		return
+	}
+
+	step, ok := security.VerifyTOTP(secret.String, request.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+		return
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled_at = NOW(), totp_last_step = $1, updated_at = NOW() WHERE id = $2", step, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+	codes, err := generateRecoveryCodes(tx, userID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Println("Error enabling two-factor authentication:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	// Recovery codes are only shown once
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "data": gin.H{"recoveryCodes": codes}})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var request struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Shares the failures of the second login step, a stolen access token
+	// cannot be used to guess the password and the code
+	limiter := security.DefaultLimiter
+	key := "2fa:" + strconv.Itoa(userID)
+	retryAfter, err := limiter.RetryAfter(key, maxTwoFactorFailures)
+	if err != nil {
+		log.Println("Error checking login attempts:", err)
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var email, storedPassword string
+	var secret sql.NullString
+	var enabledAt sql.NullTime
+	err = DB.QueryRow("SELECT email, password, totp_secret, totp_enabled_at FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(&email, &storedPassword, &secret, &enabledAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !enabledAt.Valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	fail := func(reason, message string) {
+		recordFailedLogin(DB, c, email, userID, reason)
+		delay, err := limiter.Fail(key)
+		if err != nil {
+			log.Println("Error recording login attempt:", err)
+		}
+		time.Sleep(delay)
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(request.Password)); err != nil {
+		fail("invalid_password", "Invalid password")
+		return
+	}
+	ok, err := checkSecondFactor(DB, userID, secret.String, request.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		fail("invalid_code", "Invalid code")
+		return
+	}
+	if err := limiter.Reset(key); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL, updated_at = NOW() WHERE id = $1", userID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM totp_recovery_codes WHERE user_id = $1", userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// LoginTwoFactor is the second login step, it exchanges the pre-auth token
+// returned by Login and a TOTP or recovery code for the access token
+func LoginTwoFactor(c *gin.Context) {
+	var request struct {
+		PreAuthToken string `json:"preAuthToken" binding:"required"`
+		Code         string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, _, err := configurations.ParsePurposeToken(request.PreAuthToken, preAuthPurpose)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired pre-auth token"})
+		return
+	}
+
+	limiter := security.DefaultLimiter
+	key := "2fa:" + strconv.Itoa(userID)
+	retryAfter, err := limiter.RetryAfter(key, maxTwoFactorFailures)
+	if err != nil {
+		log.Println("Error checking login attempts:", err)
+	}
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var email, name, role string
+	var secret sql.NullString
+	var emailVerifiedAt, enabledAt, suspendedAt sql.NullTime
+	err = DB.QueryRow("SELECT email, name, role, totp_secret, email_verified_at, totp_enabled_at, suspended_at FROM users WHERE id = $1 AND deleted_at IS NULL", userID).Scan(
+		&email, &name, &role, &secret, &emailVerifiedAt, &enabledAt, &suspendedAt)
+	if err != nil || !enabledAt.Valid {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired pre-auth token"})
+		return
+	}
+
+	ok, err := checkSecondFactor(DB, userID, secret.String, request.Code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !ok {
+		recordFailedLogin(DB, c, email, userID, "invalid_code")
+		delay, err := limiter.Fail(key)
+		if err != nil {
+			log.Println("Error recording login attempt:", err)
+		}
+		time.Sleep(delay)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	if err := limiter.Reset(key); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+	if suspendedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
+		return
+	}
+
+	token, err := configurations.GenerateToken(email, userID, role)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User logged successfully",
+		"data": gin.H{
+			"email":         email,
+			"name":          name,
+			"emailVerified": emailVerifiedAt.Valid,
+			"accessToken":   token,
+		},
+	})
+}
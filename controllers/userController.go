@@ -2,14 +2,39 @@ package controllers
 
 import (
 	"CatsSocial/configurations"
+	"CatsSocial/mailer"
+	"CatsSocial/security"
+	"database/sql"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	maxAccountLoginFailures = 5
+	maxIPLoginFailures      = 20
+)
+
+// dummyPasswordHash is compared when the email is unknown
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+// recordFailedLogin adds the attempt to the failed_logins audit trail,
+// userID is zero when the email is unknown
+func recordFailedLogin(DB *sql.DB, c *gin.Context, email string, userID int, reason string) {
+	_, err := DB.Exec("INSERT INTO failed_logins (email, user_id, ip_address, user_agent, reason) VALUES ($1, $2, $3, $4, $5)",
+		email, nullIfZero(userID), c.ClientIP(), c.Request.UserAgent(), reason)
+	if err != nil {
+		log.Println("Error recording failed login:", err)
+	}
+}
+
 func Register(c *gin.Context) {
 	DB, err := configurations.DBConnection()
 	if err != nil {
@@ -19,6 +44,7 @@ func Register(c *gin.Context) {
 		Email    string `json:"email" binding:"required,email"`
 		Name     string `json:"name" binding:"required,min=5,max=50"`
 		Password string `json:"password" binding:"required,min=5,max=15"`
+		Locale   string `json:"locale" binding:"omitempty,oneof=id en"`
 	}
 
 	// c.Bind(&user)
@@ -28,6 +54,7 @@ func Register(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "User min 5 and max 50 character, Pssword min 5 and max 15 character"})
 		return
 	}
+	user.Locale = mailer.NormalizeLocale(user.Locale)
 
 	rows, err := DB.Query("SELECT * FROM users WHERE email = $1", user.Email)
 	if rows.Next() {
@@ -47,7 +74,7 @@ func Register(c *gin.Context) {
 	}
 
 	// // Save user to database
-	_, err = DB.Exec("INSERT INTO users (email, name, password) VALUES ($1, $2, $3)", user.Email, user.Name, string(hashedPassword))
+	_, err = DB.Exec("INSERT INTO users (email, name, password, locale) VALUES ($1, $2, $3, $4)", user.Email, user.Name, string(hashedPassword), user.Locale)
 	if err != nil {
 		fmt.Println("tes", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
@@ -63,18 +90,27 @@ func Register(c *gin.Context) {
 	}
 
 	// Generate JWT token with user ID
-	token, err := configurations.GenerateToken(user.Email, userID)
+	token, err := configurations.GenerateToken(user.Email, userID, configurations.RoleUser)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
+	// New accounts can browse right away but stay unverified until the
+	// link in the welcome mail is opened
+	verifyURL, err := createEmailVerification(DB, userID)
+	if err != nil {
+		log.Println("Error creating email verification:", err)
+	}
+	mailer.Send(user.Email, user.Locale, mailer.Welcome, gin.H{"Name": user.Name, "VerifyURL": verifyURL})
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "User registered successfully",
 		"data": gin.H{
-			"email":       user.Email,
-			"name":        user.Name,
-			"accessToken": token,
+			"email":         user.Email,
+			"name":          user.Name,
+			"emailVerified": false,
+			"accessToken":   token,
 		},
 	})
 	defer DB.Close()
@@ -96,25 +132,95 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	// Failed attempts are counted per account and per IP address, the
+	// account key is used even for unknown emails so lockouts reveal nothing
+	accountKey := "account:" + strings.ToLower(loginReq.Email)
+	ipKey := "ip:" + c.ClientIP()
+	limiter := security.DefaultLimiter
+
+	retryAfter, err := limiter.RetryAfter(accountKey, maxAccountLoginFailures)
+	if err == nil {
+		var ipRetryAfter time.Duration
+		ipRetryAfter, err = limiter.RetryAfter(ipKey, maxIPLoginFailures)
+		if ipRetryAfter > retryAfter {
+			retryAfter = ipRetryAfter
+		}
+	}
+	if err != nil {
+		log.Println("Error checking login attempts:", err)
+	}
+	if retryAfter > 0 {
+		recordFailedLogin(DB, c, loginReq.Email, 0, "locked")
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+		return
+	}
+
 	// Fetch user from database
 	var storedPassword string
 	var userID int
 	var userEmail string
 	var userName string
-	err = DB.QueryRow(`SELECT id, email, name, password FROM users WHERE email = $1`, loginReq.Email).Scan(&userID, &userEmail, &userName, &storedPassword)
+	var userRole string
+	var emailVerifiedAt, totpEnabledAt, suspendedAt sql.NullTime
+	err = DB.QueryRow(`SELECT id, email, name, password, role, email_verified_at, totp_enabled_at, suspended_at FROM users WHERE email = $1 AND deleted_at IS NULL`, loginReq.Email).Scan(
+		&userID, &userEmail, &userName, &storedPassword, &userRole, &emailVerifiedAt, &totpEnabledAt, &suspendedAt)
+	reason := ""
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		// Compare against a dummy hash so unknown emails take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(loginReq.Password))
+		reason = "unknown_user"
+	} else if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(loginReq.Password)); err != nil {
+		reason = "invalid_password"
+	}
+
+	if reason != "" {
+		recordFailedLogin(DB, c, loginReq.Email, userID, reason)
+		delay, err := limiter.Fail(accountKey)
+		if err == nil {
+			var ipDelay time.Duration
+			ipDelay, err = limiter.Fail(ipKey)
+			if ipDelay > delay {
+				delay = ipDelay
+			}
+		}
+		if err != nil {
+			log.Println("Error recording login attempt:", err)
+		}
+		time.Sleep(delay)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		return
+	}
+
+	if err := limiter.Reset(accountKey); err != nil {
+		log.Println("Error resetting login attempts:", err)
+	}
+
+	if suspendedAt.Valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account suspended"})
 		return
 	}
 
-	// Compare passwords
-	if err := bcrypt.CompareHashAndPassword([]byte(storedPassword), []byte(loginReq.Password)); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid password"})
+	// With two-factor authentication the access token is only issued by
+	// LoginTwoFactor, in exchange of the pre-auth token and a TOTP code
+	if totpEnabledAt.Valid {
+		preAuthToken, err := generatePreAuthToken(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Two-factor authentication required",
+			"data": gin.H{
+				"twoFactorRequired": true,
+				"preAuthToken":      preAuthToken,
+			},
+		})
 		return
 	}
 
 	// Generate JWT token with user ID
-	token, err := configurations.GenerateToken(loginReq.Email, userID)
+	token, err := configurations.GenerateToken(loginReq.Email, userID, userRole)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
@@ -123,10 +229,23 @@ func Login(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User logged successfully",
 		"data": gin.H{
-			"email":       userEmail,
-			"name":        userName,
-			"accessToken": token,
+			"email":         userEmail,
+			"name":          userName,
+			"emailVerified": emailVerifiedAt.Valid,
+			"accessToken":   token,
 		},
 	})
 	defer DB.Close()
 }
+
+// mailUser renders the template in the locale of the user and queues it.
+// Failures are logged only, like notifyUser.
+func mailUser(DB *sql.DB, userID int, template string, data gin.H) {
+	var email, name, locale string
+	err := DB.QueryRow("SELECT email, name, locale FROM users WHERE id = $1", userID).Scan(&email, &name, &locale)
+	if err != nil {
+		log.Println("Error retrieving mail recipient:", err)
+		return
+	}
+	mailer.Send(email, locale, template, gin.H{"Name": name, "Data": data})
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/mailer"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	verifyEmailPurpose = "verify_email"
+	verifyEmailTTL     = 24 * time.Hour
+	// A new verification mail can be requested once per interval, and at
+	// most maxVerificationsPerDay times a day
+	verifyResendInterval   = time.Minute
+	maxVerificationsPerDay = 5
+)
+
+// hashToken returns the hex SHA-256 of a token, only hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// appURL builds a link to the frontend from APP_URL
+func appURL(path string, query url.Values) string {
+	base := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if base == "" {
+		base = "http://localhost:8080"
+	}
+	return base + path + "?" + query.Encode()
+}
+
+// createEmailVerification stores a new one-time verification and returns the
+// link to mail to the user
+func createEmailVerification(DB *sql.DB, userID int) (string, error) {
+	jti, err := generateSecret()
+	if err != nil {
+		return "", err
+	}
+	token, err := configurations.GeneratePurposeToken(userID, verifyEmailPurpose, jti, verifyEmailTTL)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = DB.Exec("INSERT INTO email_verifications (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, hashToken(jti), time.Now().Add(verifyEmailTTL))
+	if err != nil {
+		return "", err
+	}
+
+	return appURL("/verify-email", url.Values{"token": {token}}), nil
+}
+
+// isEmailVerified reports whether the user confirmed their email address
+func isEmailVerified(DB *sql.DB, userID int) (bool, error) {
+	var verifiedAt sql.NullTime
+	err := DB.QueryRow("SELECT email_verified_at FROM users WHERE id = $1", userID).Scan(&verifiedAt)
+	if err != nil {
+		return false, err
+	}
+	return verifiedAt.Valid, nil
+}
+
+func VerifyEmail(c *gin.Context) {
+	var request struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, jti, err := configurations.ParsePurposeToken(request.Token, verifyEmailPurpose)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	// Consume the verification, it can only be used once
+	result, err := DB.Exec("UPDATE email_verifications SET used_at = NOW() WHERE token_hash = $1 AND user_id = $2 AND used_at IS NULL AND expires_at > NOW()",
+		hashToken(jti), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+		return
+	}
+
+	_, err = DB.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW() WHERE id = $1", userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+func ResendVerification(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var email, name, locale string
+	var verifiedAt sql.NullTime
+	err = DB.QueryRow("SELECT email, name, locale, email_verified_at FROM users WHERE id = $1", userID).Scan(&email, &name, &locale, &verifiedAt)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if verifiedAt.Valid {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+
+	// waitSeconds is how long until the resend interval since the last mail is over
+	var sentToday, waitSeconds int
+	err = DB.QueryRow(`SELECT COUNT(*), COALESCE(CEIL(EXTRACT(EPOCH FROM MAX(created_at) + $2 * INTERVAL '1 second' - NOW())), 0)::int
+		FROM email_verifications WHERE user_id = $1 AND created_at > NOW() - INTERVAL '1 day'`,
+		userID, int(verifyResendInterval.Seconds())).Scan(&sentToday, &waitSeconds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if sentToday >= maxVerificationsPerDay {
+		c.Header("Retry-After", strconv.Itoa(int(time.Hour.Seconds())))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many verification emails requested, try again later"})
+		return
+	}
+	if waitSeconds > 0 {
+		c.Header("Retry-After", strconv.Itoa(waitSeconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait before requesting another verification email"})
+		return
+	}
+
+	link, err := createEmailVerification(DB, userID)
+	if err != nil {
+		log.Println("Error creating email verification:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	mailer.Send(email, locale, mailer.VerifyEmail, gin.H{"Name": name, "VerifyURL": link})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
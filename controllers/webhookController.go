@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"CatsSocial/configurations"
+	"CatsSocial/webhooks"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func CreateWebhook(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var webhook struct {
+		URL    string   `json:"url" binding:"required,url,max=2000"`
+		Events []string `json:"events" binding:"omitempty,dive,oneof=cat.created cat.deleted match.created match.approved match.rejected"`
+		Global bool     `json:"global"`
+	}
+	if err := c.ShouldBindJSON(&webhook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Webhooks must not reach the server itself or internal networks
+	if err := webhooks.CheckURL(webhook.URL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Global webhooks receive the events of every user
+	if webhook.Global && !configurations.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can register global webhooks"})
+		return
+	}
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	var webhookID int
+	var createdAt time.Time
+	err = DB.QueryRow("INSERT INTO webhooks (user_id, url, secret, events, is_global) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at",
+		userID, webhook.URL, secret, pq.Array(webhook.Events), webhook.Global).Scan(&webhookID, &createdAt)
+	if err != nil {
+		log.Println("Error adding webhook:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add webhook"})
+		return
+	}
+
+	// The secret is only returned once, receivers use it to verify signatures
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "success",
+		"data": gin.H{
+			"id":        strconv.Itoa(webhookID),
+			"url":       webhook.URL,
+			"events":    webhook.Events,
+			"global":    webhook.Global,
+			"secret":    secret,
+			"createdAt": createdAt.Format(time.RFC3339),
+		},
+	})
+}
+
+func GetWebhooks(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	rows, err := DB.Query("SELECT id, url, events, is_global, created_at FROM webhooks WHERE user_id = $1 AND deleted_at IS NULL ORDER BY created_at DESC", userID)
+	if err != nil {
+		log.Println("Error retrieving webhooks:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhooks"})
+		return
+	}
+	defer rows.Close()
+
+	result := []gin.H{}
+	for rows.Next() {
+		var webhook struct {
+			ID        int
+			URL       string
+			Events    []string
+			Global    bool
+			CreatedAt time.Time
+		}
+		if err := rows.Scan(&webhook.ID, &webhook.URL, pq.Array(&webhook.Events), &webhook.Global, &webhook.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhooks"})
+			return
+		}
+		if webhook.Events == nil {
+			webhook.Events = []string{}
+		}
+		result = append(result, gin.H{
+			"id":        strconv.Itoa(webhook.ID),
+			"url":       webhook.URL,
+			"events":    webhook.Events,
+			"global":    webhook.Global,
+			"createdAt": webhook.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": result, "meta": gin.H{"availableEvents": webhooks.EventTypes}})
+}
+
+func DeleteWebhook(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	tx, err := DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	defer tx.Rollback()
+
+	var webhookID int
+	err = tx.QueryRow("UPDATE webhooks SET deleted_at = NOW() WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL RETURNING id", c.Param("id"), userID).Scan(&webhookID)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	// Queued deliveries are not sent to a deleted webhook
+	if err == nil {
+		_, err = tx.Exec("UPDATE webhook_deliveries SET status = 'failed', last_error = 'Webhook deleted', updated_at = NOW() WHERE webhook_id = $1 AND status = 'pending'", webhookID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+func GetWebhookDeliveries(c *gin.Context) {
+	userID, err := configurations.GetUserFromToken(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, must be between 1 and 100"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	DB, err := configurations.DBConnection()
+	if err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	defer DB.Close()
+
+	webhookID := c.Param("id")
+	var exists bool
+	err = DB.QueryRow("SELECT EXISTS(SELECT 1 FROM webhooks WHERE id = $1 AND user_id = $2)", webhookID, userID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return
+	}
+
+	rows, err := DB.Query("SELECT id, outbox_id, event_type, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, created_at FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3",
+		webhookID, limit, offset)
+	if err != nil {
+		log.Println("Error retrieving webhook deliveries:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook deliveries"})
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []gin.H{}
+	for rows.Next() {
+		var delivery struct {
+			ID             int
+			OutboxID       int
+			EventType      string
+			Status         string
+			Attempts       int
+			NextAttemptAt  time.Time
+			LastStatusCode sql.NullInt64
+			LastError      sql.NullString
+			DeliveredAt    sql.NullTime
+			CreatedAt      time.Time
+		}
+		if err := rows.Scan(&delivery.ID, &delivery.OutboxID, &delivery.EventType, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt,
+			&delivery.LastStatusCode, &delivery.LastError, &delivery.DeliveredAt, &delivery.CreatedAt); err != nil {
+			log.Println("Error scanning row:", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook deliveries"})
+			return
+		}
+
+		item := gin.H{
+			"id":             strconv.Itoa(delivery.ID),
+			"eventId":        strconv.Itoa(delivery.OutboxID),
+			"event":          delivery.EventType,
+			"status":         delivery.Status,
+			"attempts":       delivery.Attempts,
+			"lastStatusCode": nullInt64Value(delivery.LastStatusCode),
+			"lastError":      delivery.LastError.String,
+			"nextAttemptAt":  nil,
+			"deliveredAt":    nil,
+			"createdAt":      delivery.CreatedAt.Format(time.RFC3339),
+		}
+		if delivery.Status == "pending" {
+			item["nextAttemptAt"] = delivery.NextAttemptAt.Format(time.RFC3339)
+		}
+		if delivery.DeliveredAt.Valid {
+			item["deliveredAt"] = delivery.DeliveredAt.Time.Format(time.RFC3339)
+		}
+		deliveries = append(deliveries, item)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error iterating over rows:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "success", "data": deliveries})
+}
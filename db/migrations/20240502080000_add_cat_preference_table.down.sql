@@ -0,0 +1 @@
+DROP TABLE IF EXISTS cat_preferences;
\ No newline at end of file
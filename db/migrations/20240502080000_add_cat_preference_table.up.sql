@@ -0,0 +1,14 @@
+CREATE TABLE cat_preferences (
+    id SERIAL PRIMARY KEY,
+    cat_id INTEGER UNIQUE NOT NULL,
+    accepted_races TEXT[] DEFAULT '{}',
+    min_age_in_month INTEGER,
+    max_age_in_month INTEGER,
+    max_distance_km INTEGER,
+    accept_cross_breed BOOLEAN DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (cat_id)
+        REFERENCES cats(id)
+        ON DELETE CASCADE
+);
\ No newline at end of file
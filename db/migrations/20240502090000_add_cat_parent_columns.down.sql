@@ -0,0 +1,3 @@
+ALTER TABLE cats
+    DROP COLUMN IF EXISTS sire_id,
+    DROP COLUMN IF EXISTS dam_id;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE cats
+    ADD COLUMN sire_id INTEGER REFERENCES cats(id) ON DELETE SET NULL,
+    ADD COLUMN dam_id INTEGER REFERENCES cats(id) ON DELETE SET NULL;
\ No newline at end of file
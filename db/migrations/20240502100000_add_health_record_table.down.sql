@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS health_records;
+
+ALTER TABLE cats DROP COLUMN IF EXISTS health_visibility;
\ No newline at end of file
@@ -0,0 +1,19 @@
+ALTER TABLE cats
+    ADD COLUMN health_visibility VARCHAR(20) CHECK (health_visibility IN ('private', 'match_partners')) NOT NULL DEFAULT 'private';
+
+CREATE TABLE health_records (
+    id SERIAL PRIMARY KEY,
+    cat_id INTEGER NOT NULL,
+    record_type VARCHAR(20) CHECK (record_type IN ('vaccination', 'deworming', 'vet_check')) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    performed_at DATE NOT NULL,
+    valid_until DATE,
+    notes TEXT,
+    attachment_url TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    deleted_at TIMESTAMP,
+    FOREIGN KEY (cat_id)
+        REFERENCES cats(id)
+        ON DELETE CASCADE
+);
\ No newline at end of file
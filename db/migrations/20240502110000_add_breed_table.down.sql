@@ -0,0 +1,4 @@
+ALTER TABLE cats DROP CONSTRAINT IF EXISTS cats_race_fkey;
+ALTER TABLE cats ADD CONSTRAINT cats_race_check CHECK (race IN ('Persian', 'Maine Coon', 'Siamese', 'Ragdoll', 'Bengal', 'Sphynx', 'British Shorthair', 'Abyssinian', 'Scottish Fold', 'Birman'));
+
+DROP TABLE IF EXISTS breeds;
\ No newline at end of file
@@ -0,0 +1,24 @@
+CREATE TABLE breeds (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(50) UNIQUE NOT NULL,
+    aliases TEXT[] DEFAULT '{}',
+    origin VARCHAR(100),
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO breeds (name, aliases, origin) VALUES
+    ('Persian', '{"Persian Longhair"}', 'Iran'),
+    ('Maine Coon', '{"Mainecoon"}', 'United States'),
+    ('Siamese', '{}', 'Thailand'),
+    ('Ragdoll', '{}', 'United States'),
+    ('Bengal', '{}', 'United States'),
+    ('Sphynx', '{"Canadian Hairless"}', 'Canada'),
+    ('British Shorthair', '{"BSH"}', 'United Kingdom'),
+    ('Abyssinian', '{}', 'Ethiopia'),
+    ('Scottish Fold', '{}', 'Scotland'),
+    ('Birman', '{"Sacred Cat of Burma"}', 'Myanmar');
+
+ALTER TABLE cats DROP CONSTRAINT IF EXISTS cats_race_check;
+ALTER TABLE cats ADD CONSTRAINT cats_race_fkey FOREIGN KEY (race) REFERENCES breeds(name) ON UPDATE CASCADE;
\ No newline at end of file
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS users_location_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS longitude;
+
+DROP TABLE IF EXISTS cities;
\ No newline at end of file
@@ -0,0 +1,35 @@
+CREATE TABLE cities (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    latitude NUMERIC(5, 2) NOT NULL,
+    longitude NUMERIC(5, 2) NOT NULL
+);
+
+INSERT INTO cities (name, latitude, longitude) VALUES
+    ('Jakarta', -6.21, 106.85),
+    ('Surabaya', -7.25, 112.75),
+    ('Bandung', -6.91, 107.61),
+    ('Medan', 3.60, 98.67),
+    ('Semarang', -6.97, 110.42),
+    ('Makassar', -5.15, 119.43),
+    ('Palembang', -2.98, 104.76),
+    ('Tangerang', -6.18, 106.63),
+    ('Depok', -6.40, 106.82),
+    ('Bekasi', -6.24, 106.99),
+    ('Bogor', -6.60, 106.80),
+    ('Yogyakarta', -7.80, 110.36),
+    ('Malang', -7.98, 112.63),
+    ('Denpasar', -8.65, 115.22),
+    ('Balikpapan', -1.24, 116.85),
+    ('Pekanbaru', 0.51, 101.45),
+    ('Padang', -0.95, 100.35),
+    ('Manado', 1.47, 124.84),
+    ('Pontianak', -0.03, 109.33),
+    ('Banjarmasin', -3.32, 114.59);
+
+ALTER TABLE users
+    ADD COLUMN city VARCHAR(100),
+    ADD COLUMN latitude NUMERIC(5, 2),
+    ADD COLUMN longitude NUMERIC(5, 2);
+
+CREATE INDEX users_location_idx ON users (latitude, longitude);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS match_messages;
\ No newline at end of file
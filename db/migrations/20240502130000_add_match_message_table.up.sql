@@ -0,0 +1,13 @@
+CREATE TABLE match_messages (
+    id SERIAL PRIMARY KEY,
+    match_id INTEGER NOT NULL,
+    sender_id INTEGER REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    body TEXT NOT NULL,
+    read_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (match_id)
+        REFERENCES match_cats(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX match_messages_match_id_idx ON match_messages (match_id, created_at);
\ No newline at end of file
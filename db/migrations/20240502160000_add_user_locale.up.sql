@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN locale VARCHAR(2) NOT NULL DEFAULT 'id' CHECK (locale IN ('id', 'en'));
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN avatar_url TEXT;
\ No newline at end of file
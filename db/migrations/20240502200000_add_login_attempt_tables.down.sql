@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS failed_logins;
+
+DROP TABLE IF EXISTS login_attempts;
\ No newline at end of file
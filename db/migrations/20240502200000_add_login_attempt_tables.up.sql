@@ -0,0 +1,21 @@
+CREATE TABLE login_attempts (
+    key VARCHAR(320) PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE failed_logins (
+    id SERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    user_id INTEGER,
+    ip_address VARCHAR(45),
+    user_agent TEXT,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('unknown_user', 'invalid_password', 'locked')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX failed_logins_email_idx ON failed_logins (email, created_at);
+CREATE INDEX failed_logins_ip_address_idx ON failed_logins (ip_address, created_at);
\ No newline at end of file
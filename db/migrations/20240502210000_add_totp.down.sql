@@ -0,0 +1,12 @@
+DELETE FROM failed_logins WHERE reason = 'invalid_code';
+
+ALTER TABLE failed_logins
+    DROP CONSTRAINT failed_logins_reason_check,
+    ADD CONSTRAINT failed_logins_reason_check CHECK (reason IN ('unknown_user', 'invalid_password', 'locked'));
+
+DROP TABLE IF EXISTS totp_recovery_codes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS totp_secret,
+    DROP COLUMN IF EXISTS totp_enabled_at,
+    DROP COLUMN IF EXISTS totp_last_step;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_role_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role,
+    DROP COLUMN IF EXISTS suspended_at,
+    DROP COLUMN IF EXISTS suspension_reason;
\ No newline at end of file
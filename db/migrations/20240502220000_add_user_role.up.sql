@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin')),
+    ADD COLUMN suspended_at TIMESTAMP,
+    ADD COLUMN suspension_reason VARCHAR(500);
+
+-- Promote the first admin manually:
+-- UPDATE users SET role = 'admin' WHERE email = '...';
+CREATE INDEX users_role_idx ON users (role);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS reports;
+
+ALTER TABLE cats
+    DROP COLUMN IF EXISTS hidden_at,
+    DROP COLUMN IF EXISTS flagged_at;
\ No newline at end of file
@@ -0,0 +1,28 @@
+ALTER TABLE cats
+    ADD COLUMN hidden_at TIMESTAMP,
+    ADD COLUMN flagged_at TIMESTAMP;
+
+CREATE TABLE reports (
+    id SERIAL PRIMARY KEY,
+    -- NULL when the report was raised by the word filter
+    reporter_id INTEGER,
+    target_type VARCHAR(10) NOT NULL CHECK (target_type IN ('cat', 'user', 'message')),
+    target_id INTEGER NOT NULL,
+    reason VARCHAR(20) NOT NULL CHECK (reason IN ('spam', 'inappropriate', 'harassment', 'fraud', 'animal_welfare', 'other', 'word_filter')),
+    details VARCHAR(500),
+    status VARCHAR(10) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    action VARCHAR(20) CHECK (action IN ('hide_cat', 'suspend_user', 'dismiss')),
+    resolved_by INTEGER,
+    resolved_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (reporter_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at);
+CREATE INDEX reports_target_idx ON reports (target_type, target_id);
+CREATE UNIQUE INDEX reports_open_reporter_target_idx ON reports (reporter_id, target_type, target_id) WHERE status = 'open';
\ No newline at end of file
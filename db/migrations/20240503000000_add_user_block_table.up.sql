@@ -0,0 +1,15 @@
+CREATE TABLE user_blocks (
+    blocker_id INTEGER NOT NULL,
+    blocked_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id),
+    FOREIGN KEY (blocker_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX user_blocks_blocked_id_idx ON user_blocks (blocked_id);
\ No newline at end of file
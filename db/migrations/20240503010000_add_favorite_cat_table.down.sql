@@ -0,0 +1 @@
+DROP TABLE IF EXISTS favorite_cats;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE favorite_cats (
+    user_id INTEGER NOT NULL,
+    cat_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, cat_id),
+    FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (cat_id)
+        REFERENCES cats(id)
+        ON DELETE CASCADE
+);
+
+CREATE INDEX favorite_cats_cat_id_idx ON favorite_cats (cat_id);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS cats_record_revision ON cats;
+DROP TRIGGER IF EXISTS cats_set_updated_at ON cats;
+DROP FUNCTION IF EXISTS record_cat_revision();
+DROP FUNCTION IF EXISTS set_updated_at();
+DROP TABLE IF EXISTS cat_revisions;
\ No newline at end of file
@@ -0,0 +1,81 @@
+CREATE TABLE cat_revisions (
+    id SERIAL PRIMARY KEY,
+    cat_id INTEGER NOT NULL,
+    actor_id INTEGER,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore', 'hide', 'unhide', 'match', 'unmatch')),
+    changes JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (cat_id)
+        REFERENCES cats(id)
+        ON DELETE CASCADE,
+    FOREIGN KEY (actor_id)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX cat_revisions_cat_id_idx ON cat_revisions (cat_id, created_at);
+
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER cats_set_updated_at
+    BEFORE UPDATE ON cats
+    FOR EACH ROW
+    WHEN (OLD.* IS DISTINCT FROM NEW.*)
+    EXECUTE FUNCTION set_updated_at();
+
+-- The actor is read from the app.actor_id setting of the transaction,
+-- revisions written without it are system changes
+CREATE OR REPLACE FUNCTION record_cat_revision() RETURNS TRIGGER AS $$
+DECLARE
+    old_row JSONB := '{}';
+    new_row JSONB := to_jsonb(NEW) - 'id' - 'created_at' - 'updated_at';
+    changes JSONB := '{}';
+    col TEXT;
+    revision_action VARCHAR(20) := 'update';
+BEGIN
+    IF TG_OP = 'UPDATE' THEN
+        old_row := to_jsonb(OLD) - 'id' - 'created_at' - 'updated_at';
+    END IF;
+
+    FOR col IN SELECT jsonb_object_keys(new_row) LOOP
+        IF TG_OP = 'INSERT' AND new_row -> col = 'null'::JSONB THEN
+            CONTINUE;
+        END IF;
+        IF old_row -> col IS DISTINCT FROM new_row -> col THEN
+            changes := changes || jsonb_build_object(col, jsonb_build_object('old', old_row -> col, 'new', new_row -> col));
+        END IF;
+    END LOOP;
+
+    IF changes = '{}' THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        revision_action := 'create';
+    ELSIF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+        revision_action := 'delete';
+    ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+        revision_action := 'restore';
+    ELSIF OLD.hidden_at IS NULL AND NEW.hidden_at IS NOT NULL THEN
+        revision_action := 'hide';
+    ELSIF OLD.hidden_at IS NOT NULL AND NEW.hidden_at IS NULL THEN
+        revision_action := 'unhide';
+    ELSIF OLD.has_matched IS DISTINCT FROM NEW.has_matched THEN
+        revision_action := CASE WHEN NEW.has_matched THEN 'match' ELSE 'unmatch' END;
+    END IF;
+
+    INSERT INTO cat_revisions (cat_id, actor_id, action, changes)
+    VALUES (NEW.id, NULLIF(current_setting('app.actor_id', true), '')::INTEGER, revision_action, changes);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER cats_record_revision
+    AFTER INSERT OR UPDATE ON cats
+    FOR EACH ROW
+    EXECUTE FUNCTION record_cat_revision();
\ No newline at end of file
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is pushed to the user identified by UserID
+type Event struct {
+	Type      string      `json:"type"`
+	UserID    int         `json:"userId"`
+	Data      interface{} `json:"data"`
+	CreatedAt time.Time   `json:"createdAt"`
+}
+
+const (
+	MatchReceived  = "match.received"
+	MatchApproved  = "match.approved"
+	MatchRejected  = "match.rejected"
+	MatchWithdrawn = "match.withdrawn"
+	MessageCreated = "message.created"
+	// Sent to the users who favorited the cat
+	FavoriteAvailable = "favorite.available"
+	FavoriteDeleted   = "favorite.deleted"
+	// Sent when a personal data archive can be downloaded
+	DataExportReady = "data_export.ready"
+)
+
+// Hub keeps the event channels of the clients connected to this instance
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan Event]struct{}
+}
+
+// DefaultHub is the hub used by the HTTP handlers and the postgres listener
+var DefaultHub = NewHub()
+
+func NewHub() *Hub {
+	return &Hub{subscribers: map[int]map[chan Event]struct{}{}}
+}
+
+// Subscribe returns a channel receiving every event for the user
+func (h *Hub) Subscribe(userID int) chan Event {
+	ch := make(chan Event, 16)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = map[chan Event]struct{}{}
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	return ch
+}
+
+func (h *Hub) Unsubscribe(userID int, ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers[userID], ch)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+}
+
+// Dispatch delivers the event to the local subscribers of the user. Slow
+// clients whose buffer is full miss the event instead of blocking the hub.
+func (h *Hub) Dispatch(event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
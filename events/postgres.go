@@ -0,0 +1,74 @@
+package events
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// channel is the postgres NOTIFY channel shared by every replica
+const channel = "cat_social_events"
+
+var listening atomic.Bool
+
+// Publish sends the event through postgres NOTIFY so the replica holding the
+// user connection can deliver it. Without a running listener the event is
+// only dispatched to this instance.
+func Publish(db *sql.DB, event Event) {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	if listening.Load() {
+		payload, err := json.Marshal(event)
+		if err == nil {
+			_, err = db.Exec("SELECT pg_notify($1, $2)", channel, string(payload))
+		}
+		if err == nil {
+			return
+		}
+		log.Println("Error publishing event:", err)
+	}
+	DefaultHub.Dispatch(event)
+}
+
+// Listen subscribes to the postgres channel and dispatches every notification
+// to DefaultHub until the process exits
+func Listen(connectionString string) error {
+	listener := pq.NewListener(connectionString, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("Event listener:", err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return err
+	}
+	listening.Store(true)
+
+	go func() {
+		for {
+			select {
+			case notification := <-listener.Notify:
+				// nil is sent after a reconnect, events in between are lost
+				if notification == nil {
+					continue
+				}
+				var event Event
+				if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+					log.Println("Error decoding event:", err)
+					continue
+				}
+				DefaultHub.Dispatch(event)
+			case <-time.After(90 * time.Second):
+				go listener.Ping()
+			}
+		}
+	}()
+
+	return nil
+}
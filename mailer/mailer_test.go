@@ -0,0 +1,214 @@
+package mailer
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP is a minimal SMTP server accepting one message per connection
+type fakeSMTP struct {
+	listener net.Listener
+	messages chan smtpMessage
+}
+
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{listener: listener, messages: make(chan smtpMessage, 1)}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeSMTP) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTP) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var msg smtpMessage
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<>")
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			msg.data = data.String()
+			s.messages <- msg
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newFakeSMTP(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	m, err := NewSMTPMailer(host, port, "", "", "CatsSocial <no-reply@catssocial.local>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := Render("Budi <budi@example.com>", "id", Welcome, map[string]string{"Name": "Budi", "VerifyURL": "http://localhost/verify?token=abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := <-server.messages
+	if got.from != "no-reply@catssocial.local" || len(got.to) != 1 || got.to[0] != "budi@example.com" {
+		t.Fatalf("envelope = %q to %q", got.from, got.to)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != "Selamat datang di CatsSocial, Budi!" {
+		t.Errorf("subject = %q, %v", subject, err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q, %v", mediaType, err)
+	}
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+	}
+	if !strings.Contains(parts["text/plain"], "Halo Budi,") || !strings.Contains(parts["text/plain"], "http://localhost/verify?token=abc") {
+		t.Errorf("text part = %q", parts["text/plain"])
+	}
+	if !strings.Contains(parts["text/html"], `<a href="http://localhost/verify?token=abc">`) {
+		t.Errorf("html part = %q", parts["text/html"])
+	}
+}
+
+func TestNewSMTPMailerRequiresHost(t *testing.T) {
+	if _, err := NewSMTPMailer("", "25", "", "", "no-reply@catssocial.local"); err == nil {
+		t.Error("NewSMTPMailer() accepted an empty host")
+	}
+	if _, err := NewSMTPMailer("localhost", "25", "", "", "not an address"); err == nil {
+		t.Error("NewSMTPMailer() accepted an invalid from address")
+	}
+}
+
+func TestRenderEveryTemplate(t *testing.T) {
+	data := map[string]string{
+		"Name":             "Budi",
+		"VerifyURL":        "http://localhost/verify",
+		"ResetURL":         "http://localhost/reset",
+		"AcceptURL":        "http://localhost/accept",
+		"CatName":          "Milo",
+		"MatchCatName":     "Luna",
+		"OrganizationName": "Cattery",
+	}
+	for _, name := range []string{Welcome, VerifyEmail, ResetPassword, MatchReceived, MatchApproved, MatchRejected, OrgInvitation} {
+		for _, locale := range Locales {
+			msg, err := Render("budi@example.com", locale, name, data)
+			if err != nil {
+				t.Errorf("Render(%s, %s) error: %v", name, locale, err)
+				continue
+			}
+			if msg.Subject == "" || strings.Contains(msg.Subject, "\n") || msg.Text == "" || msg.HTML == "" {
+				t.Errorf("Render(%s, %s) = %+v, want a one line subject and both bodies", name, locale, msg)
+			}
+		}
+	}
+}
+
+func TestRenderLocaleAndEscaping(t *testing.T) {
+	tests := []struct {
+		locale  string
+		subject string
+	}{
+		{"en", "Welcome to CatsSocial, <b>Budi</b>!"},
+		{"en-US", "Welcome to CatsSocial, <b>Budi</b>!"},
+		{"id", "Selamat datang di CatsSocial, <b>Budi</b>!"},
+		{"fr", "Selamat datang di CatsSocial, <b>Budi</b>!"},
+		{"", "Selamat datang di CatsSocial, <b>Budi</b>!"},
+	}
+	for _, tt := range tests {
+		msg, err := Render("budi@example.com", tt.locale, Welcome, map[string]string{"Name": "<b>Budi</b>"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != tt.subject {
+			t.Errorf("Render(%q) subject = %q, want %q", tt.locale, msg.Subject, tt.subject)
+		}
+		if strings.Contains(msg.HTML, "<b>Budi</b>") || !strings.Contains(msg.HTML, "&lt;b&gt;Budi&lt;/b&gt;") {
+			t.Errorf("Render(%q) html does not escape the name: %q", tt.locale, msg.HTML)
+		}
+	}
+
+	if _, err := Render("budi@example.com", "en", "unknown", nil); err == nil {
+		t.Error("Render() of an unknown template succeeded")
+	}
+}
@@ -0,0 +1,75 @@
+package mailer
+
+import (
+	"log"
+	"time"
+)
+
+const maxSendAttempts = 3
+
+// Queue sends messages in the background so handlers do not wait on the
+// mail server. Messages still queued when the process exits are lost.
+type Queue struct {
+	mailer   Mailer
+	messages chan Message
+	// RetryDelay is the wait before a failed message is sent again
+	RetryDelay time.Duration
+}
+
+// DefaultQueue is used by the HTTP handlers, it is set by Start
+var DefaultQueue *Queue
+
+func NewQueue(mailer Mailer, size int) *Queue {
+	q := &Queue{mailer: mailer, messages: make(chan Message, size), RetryDelay: 10 * time.Second}
+	go q.run()
+	return q
+}
+
+// Start builds the mailer from the environment and sets DefaultQueue
+func Start() error {
+	m, err := FromEnv()
+	if err != nil {
+		return err
+	}
+	DefaultQueue = NewQueue(m, 100)
+	return nil
+}
+
+// Enqueue adds the message to the queue, it is dropped when the queue is full
+func (q *Queue) Enqueue(msg Message) {
+	select {
+	case q.messages <- msg:
+	default:
+		log.Println("Mail queue full, dropping mail to", msg.To)
+	}
+}
+
+func (q *Queue) run() {
+	for msg := range q.messages {
+		for attempt := 1; ; attempt++ {
+			err := q.mailer.Send(msg)
+			if err == nil {
+				break
+			}
+			if attempt >= maxSendAttempts {
+				log.Println("Failed to send mail to", msg.To+":", err)
+				break
+			}
+			time.Sleep(q.RetryDelay * time.Duration(attempt))
+		}
+	}
+}
+
+// Send renders the template and queues it on DefaultQueue
+func Send(to, locale, name string, data interface{}) {
+	if DefaultQueue == nil {
+		log.Println("Mail queue not started, dropping mail to", to)
+		return
+	}
+	msg, err := Render(to, locale, name, data)
+	if err != nil {
+		log.Println("Error rendering mail:", err)
+		return
+	}
+	DefaultQueue.Enqueue(msg)
+}
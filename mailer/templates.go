@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	Welcome       = "welcome"
+	VerifyEmail   = "verify_email"
+	ResetPassword = "reset_password"
+	MatchReceived = "match.received"
+	MatchApproved = "match.approved"
+	MatchRejected = "match.rejected"
+	OrgInvitation = "org_invitation"
+)
+
+// Locales supported by the templates, the first one is the fallback
+var Locales = []string{"id", "en"}
+
+//go:embed templates
+var templateFS embed.FS
+
+// Every template has a "<name>.<locale>.txt" file defining "subject" and the
+// text body, and a "<name>.<locale>.html" file with the HTML body. Files are
+// parsed on their own so the "subject" blocks do not override each other.
+var (
+	textTemplates = map[string]*texttemplate.Template{}
+	htmlTemplates = map[string]*htmltemplate.Template{}
+)
+
+func init() {
+	files, err := fs.Glob(templateFS, "templates/*")
+	if err != nil {
+		panic(err)
+	}
+	for _, file := range files {
+		name := path.Base(file)
+		switch path.Ext(name) {
+		case ".txt":
+			textTemplates[strings.TrimSuffix(name, ".txt")] = texttemplate.Must(texttemplate.ParseFS(templateFS, file))
+		case ".html":
+			htmlTemplates[strings.TrimSuffix(name, ".html")] = htmltemplate.Must(htmltemplate.ParseFS(templateFS, file))
+		}
+	}
+}
+
+// NormalizeLocale returns the supported locale matching the given one, or the fallback
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	for _, supported := range Locales {
+		if locale == supported {
+			return locale
+		}
+	}
+	return Locales[0]
+}
+
+// HasTemplate reports whether a mail exists for the given name
+func HasTemplate(name string) bool {
+	_, ok := textTemplates[name+"."+Locales[0]]
+	return ok
+}
+
+// Render builds the message for the template name in the locale of the recipient
+func Render(to, locale, name string, data interface{}) (Message, error) {
+	file := name + "." + NormalizeLocale(locale)
+
+	text, html := textTemplates[file], htmlTemplates[file]
+	if text == nil || html == nil {
+		return Message{}, fmt.Errorf("mail template %q not found", file)
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.Execute(&textBody, data); err != nil {
+		return Message{}, err
+	}
+	if err := html.Execute(&htmlBody, data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(textBody.String()) + "\n",
+		HTML:    htmlBody.String(),
+	}, nil
+}
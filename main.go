@@ -3,7 +3,15 @@ package main
 import (
 	"CatsSocial/configurations"
 	"CatsSocial/controllers"
+	"CatsSocial/events"
+	"CatsSocial/mailer"
+	"CatsSocial/maintenance"
+	"CatsSocial/privacy"
+	"CatsSocial/security"
+	"CatsSocial/webhooks"
 	"log"
+	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -16,29 +24,185 @@ func main() {
 	}
 	// Baca nilai variabel lingkungan untuk koneksi database
 
+	// Kunci JWT dibaca setelah file .env dimuat
+	if err := configurations.LoadJWTSecret(); err != nil {
+		log.Fatal("Failed to configure tokens:", err)
+	}
+
+	// Tolak token dari sesi yang sudah dicabut, misalnya setelah reset password
+	configurations.SetRevocationDB(DB)
+
+	// Simpan percobaan login yang gagal untuk penguncian akun
+	attemptStore, err := security.StoreFromEnv(DB)
+	if err != nil {
+		log.Fatal("Failed to configure login attempt store:", err)
+	}
+	security.DefaultLimiter = security.NewLimiter(attemptStore)
+
+	// Teruskan event antar replika melalui postgres LISTEN/NOTIFY
+	if err := events.Listen(configurations.DBConnectionString()); err != nil {
+		log.Println("Failed to listen for events, realtime updates limited to this instance:", err)
+	}
+
+	// Kirim email melalui antrean di latar belakang
+	if err := mailer.Start(); err != nil {
+		log.Fatal("Failed to configure mailer:", err)
+	}
+
+	// Kirim webhook dari outbox di latar belakang
+	webhooks.NewDispatcher(DB).Start()
+
+	// Hapus permanen data yang sudah lama dihapus
+	purger, err := maintenance.PurgerFromEnv(DB)
+	if err != nil {
+		log.Fatal("Failed to configure retention purge:", err)
+	}
+	maintenance.DefaultPurger = purger
+	purger.Start()
+
+	// Buat arsip data pribadi yang diminta pengguna di latar belakang
+	exporter, err := privacy.NewExporter(DB)
+	if err != nil {
+		log.Fatal("Failed to configure data exporter:", err)
+	}
+	exporter.OnReady = func(userID, exportID int) {
+		controllers.NotifyDataExportReady(DB, userID, exportID)
+	}
+	exporter.Start()
+
 	// Inisialisasi router Gin
 	router := gin.Default()
 
+	// Alamat klien dipakai untuk penguncian login, X-Forwarded-For hanya
+	// dipercaya dari proxy di TRUSTED_PROXIES
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// Atur rute untuk register dan login
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"*"} // Atur origin sesuai kebutuhan Anda, "*" untuk memperbolehkan dari semua origin
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	config.AddAllowHeaders("If-Match")
+	config.AddExposeHeaders("ETag")
 	router.Use(cors.New(config))
 
 	// Atur rute untuk register dan login
 	router.POST("/v1/user/register", controllers.Register)
 	router.POST("/v1/user/login", controllers.Login)
+	router.POST("/v1/user/login/2fa", controllers.LoginTwoFactor)
+	router.POST("/v1/user/verify", controllers.VerifyEmail)
+	router.POST("/v1/user/verify/resend", controllers.ResendVerification)
+	router.POST("/v1/user/password/forgot", controllers.ForgotPassword)
+	router.POST("/v1/user/password/reset", controllers.ResetPassword)
+	router.GET("/v1/user/me", controllers.GetProfile)
+	router.PATCH("/v1/user/me", controllers.UpdateProfile)
+	router.DELETE("/v1/user/me", controllers.DeleteAccount)
+	router.PUT("/v1/user/me/password", controllers.ChangePassword)
+	router.PUT("/v1/user/me/avatar", controllers.UpdateAvatar)
+	router.POST("/v1/user/me/2fa/setup", controllers.SetupTwoFactor)
+	router.POST("/v1/user/me/2fa/confirm", controllers.ConfirmTwoFactor)
+	router.POST("/v1/user/me/2fa/disable", controllers.DisableTwoFactor)
+	router.POST("/v1/user/me/erase", controllers.EraseAccount)
+	router.POST("/v1/user/me/exports", controllers.RequestDataExport)
+	router.GET("/v1/user/me/exports/:id", controllers.GetDataExport)
+	router.GET("/v1/user/me/exports/:id/download", controllers.DownloadDataExport)
+	router.GET("/v1/user/location", controllers.GetLocation)
+	router.PUT("/v1/user/location", controllers.UpdateLocation)
+	router.DELETE("/v1/user/location", controllers.DeleteLocation)
+	router.POST("/v1/user/:id/report", controllers.ReportUser)
+	router.GET("/v1/user/blocks", controllers.GetBlockedUsers)
+	router.POST("/v1/user/:id/block", controllers.BlockUser)
+	router.DELETE("/v1/user/:id/block", controllers.UnblockUser)
+
+	router.GET("/v1/breeds", controllers.GetBreeds)
+
+	router.POST("/v1/organizations", controllers.CreateOrganization)
+	router.GET("/v1/organizations", controllers.GetOrganizations)
+	router.POST("/v1/organizations/invitations/accept", controllers.AcceptOrganizationInvitation)
+	router.GET("/v1/organizations/:id", controllers.GetOrganization)
+	router.GET("/v1/organizations/:id/cats", controllers.GetOrganizationCats)
+	router.POST("/v1/organizations/:id/invitations", controllers.InviteOrganizationMember)
+	router.PUT("/v1/organizations/:id/members/:userId/role", controllers.UpdateOrganizationMemberRole)
+	router.DELETE("/v1/organizations/:id/members/:userId", controllers.RemoveOrganizationMember)
+
+	// Rute admin, peran diperiksa oleh middleware
+	admin := router.Group("/v1/admin", configurations.RequireRole(configurations.RoleAdmin))
+	admin.POST("/breeds", controllers.CreateBreed)
+	admin.GET("/users", controllers.AdminGetUsers)
+	admin.PUT("/users/:id/role", controllers.AdminUpdateUserRole)
+	admin.POST("/users/:id/suspend", controllers.AdminSuspendUser)
+	admin.POST("/users/:id/unsuspend", controllers.AdminUnsuspendUser)
+	admin.POST("/purge", controllers.AdminPurge)
+
+	moderation := router.Group("/v1/admin", configurations.RequireRole(configurations.RoleModerator, configurations.RoleAdmin))
+	moderation.GET("/cats/deleted", controllers.AdminGetDeletedCats)
+	moderation.POST("/cats/:id/restore", controllers.AdminRestoreCat)
+	moderation.GET("/matches/deleted", controllers.AdminGetDeletedMatches)
+	moderation.POST("/matches/:id/restore", controllers.AdminRestoreMatch)
+	moderation.GET("/reports", controllers.AdminGetReports)
+	moderation.POST("/reports/:id/resolve", controllers.ResolveReport)
+	moderation.POST("/cats/:id/unhide", controllers.AdminUnhideCat)
 
 	router.POST("/v1/cat", controllers.CreateCat)
 	router.GET("/v1/cat", controllers.GetCats)
+	router.POST("/v1/cat/import", controllers.ImportCats)
+	router.GET("/v1/cat/export", controllers.ExportCats)
 	router.PUT("/v1/cat/:id", controllers.UpdateCat)
+	router.PATCH("/v1/cat/:id", controllers.PatchCat)
 	router.DELETE("/v1/cat/:id", controllers.DeleteCat)
+	router.POST("/v1/cat/:id/restore", controllers.RestoreCat)
+	router.POST("/v1/cat/:id/transfer", controllers.TransferCat)
+	router.POST("/v1/cat/:id/report", controllers.ReportCat)
+	router.GET("/v1/cat/:id/history", controllers.GetCatHistory)
+	router.GET("/v1/cat/favorites", controllers.GetFavoriteCats)
+	router.POST("/v1/cat/:id/favorite", controllers.AddFavoriteCat)
+	router.DELETE("/v1/cat/:id/favorite", controllers.RemoveFavoriteCat)
+
+	router.POST("/v1/cat/:id/preference", controllers.CreatePreference)
+	router.GET("/v1/cat/:id/preference", controllers.GetPreference)
+	router.PUT("/v1/cat/:id/preference", controllers.UpdatePreference)
+	router.DELETE("/v1/cat/:id/preference", controllers.DeletePreference)
+
+	router.GET("/v1/cat/:id/pedigree", controllers.GetPedigree)
+	router.GET("/v1/cat/:id/inbreeding", controllers.GetInbreeding)
+
+	router.POST("/v1/cat/:id/health", controllers.CreateHealthRecord)
+	router.GET("/v1/cat/:id/health", controllers.GetHealthRecords)
+	router.PUT("/v1/cat/:id/health/visibility", controllers.UpdateHealthVisibility)
+	router.PUT("/v1/cat/:id/health/:recordId", controllers.UpdateHealthRecord)
+	router.PUT("/v1/cat/:id/health/:recordId/attachment", controllers.UploadHealthAttachment)
+	router.DELETE("/v1/cat/:id/health/:recordId", controllers.DeleteHealthRecord)
 
 	router.POST("/v1/cat/match", controllers.CreateMatch)
 	router.GET("/v1/cat/match", controllers.GetMatchRequests)
 	router.POST("/v1/cat/match/approve", controllers.ApproveMatch)
 	router.POST("/v1/cat/match/reject", controllers.RejectMatch)
 	router.DELETE("/v1/cat/match/:id", controllers.DeleteMatch)
+
+	router.POST("/v1/events/token", controllers.CreateEventStreamToken)
+	router.GET("/v1/events", controllers.StreamEvents)
+	router.GET("/v1/events/ws", controllers.EventsWebSocket)
+
+	router.GET("/v1/notifications", controllers.GetNotifications)
+	router.POST("/v1/notifications/read-all", controllers.MarkAllNotificationsRead)
+	router.POST("/v1/notifications/:id/read", controllers.MarkNotificationRead)
+
+	router.GET("/v1/cat/match/:id/messages", controllers.GetMatchMessages)
+	router.POST("/v1/cat/match/:id/messages", controllers.SendMatchMessage)
+	router.POST("/v1/cat/match/:id/messages/read", controllers.MarkMatchMessagesRead)
+	router.POST("/v1/cat/match/:id/messages/:messageId/report", controllers.ReportMessage)
+
+	router.POST("/v1/webhooks", controllers.CreateWebhook)
+	router.GET("/v1/webhooks", controllers.GetWebhooks)
+	router.DELETE("/v1/webhooks/:id", controllers.DeleteWebhook)
+	router.GET("/v1/webhooks/:id/deliveries", controllers.GetWebhookDeliveries)
 	// Jalankan server HTTP
 	router.Run(":8080")
 	defer DB.Close()
@@ -0,0 +1,162 @@
+package maintenance
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ImageStore stores the files behind image URLs, like avatars, and removes them
+type ImageStore interface {
+	// Save stores the file under name and returns its URL
+	Save(name string, r io.Reader) (string, error)
+	// Open returns the file behind url, ErrNotStored when it is hosted elsewhere
+	Open(url string) (io.ReadCloser, error)
+	Delete(url string) error
+}
+
+// ErrNotStored is returned by Open for images the store does not hold
+var ErrNotStored = errors.New("image is not in the image storage")
+
+// ImageStoreFromEnv returns a DirImageStore when IMAGE_STORE_DIR is set,
+// otherwise images are hosted elsewhere, uploads are refused and removals
+// are only logged
+func ImageStoreFromEnv() ImageStore {
+	dir := os.Getenv("IMAGE_STORE_DIR")
+	if dir == "" {
+		return LogImageStore{}
+	}
+	return &DirImageStore{Dir: dir, BaseURL: os.Getenv("IMAGE_BASE_URL")}
+}
+
+// DeleteUnreferenced deletes the images no cat, avatar or health record refers
+// to anymore. Image URLs are free-form, so the URL of a removed cat can still
+// be used by another user and must not be deleted with it.
+func DeleteUnreferenced(db *sql.DB, store ImageStore, urls []string) error {
+	if len(urls) == 0 {
+		return nil
+	}
+	rows, err := db.Query(`SELECT DISTINCT url FROM unnest($1::text[]) url
+		WHERE NOT EXISTS(SELECT 1 FROM cats WHERE cats.image_urls @> ARRAY[url])
+		AND NOT EXISTS(SELECT 1 FROM users WHERE users.avatar_url = url)
+		AND NOT EXISTS(SELECT 1 FROM health_records WHERE health_records.attachment_url = url)`, pq.Array(urls))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var unreferenced []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return err
+		}
+		unreferenced = append(unreferenced, url)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The rows are gone, an image that fails to delete is only logged
+	for _, url := range unreferenced {
+		if err := store.Delete(url); err != nil {
+			log.Println("Error deleting image:", err)
+		}
+	}
+	return nil
+}
+
+// LogImageStore only writes the removed image URLs to the log
+type LogImageStore struct{}
+
+func (LogImageStore) Save(name string, r io.Reader) (string, error) {
+	return "", fmt.Errorf("image storage is not configured, set IMAGE_STORE_DIR")
+}
+
+func (LogImageStore) Open(url string) (io.ReadCloser, error) {
+	return nil, ErrNotStored
+}
+
+func (LogImageStore) Delete(url string) error {
+	log.Println("Deleted image:", url)
+	return nil
+}
+
+// DirImageStore deletes the images served from Dir under BaseURL, URLs
+// outside of BaseURL are not ours and are left alone
+type DirImageStore struct {
+	Dir     string
+	BaseURL string
+}
+
+// Save writes the file into Dir, name may contain directories. Existing files
+// are never overwritten.
+func (s *DirImageStore) Save(name string, r io.Reader) (string, error) {
+	if s.BaseURL == "" {
+		return "", fmt.Errorf("IMAGE_BASE_URL is required to store images")
+	}
+	name = filepath.Clean("/" + name)
+	if name == "/" {
+		return "", fmt.Errorf("invalid image name %q", name)
+	}
+
+	path := filepath.Join(s.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return strings.TrimRight(s.BaseURL, "/") + filepath.ToSlash(name), nil
+}
+
+// path returns the file of url, ok is false for URLs outside of BaseURL
+func (s *DirImageStore) path(url string) (string, bool, error) {
+	base := strings.TrimRight(s.BaseURL, "/") + "/"
+	if !strings.HasPrefix(url, base) {
+		return "", false, nil
+	}
+	name := filepath.Clean("/" + strings.TrimPrefix(url, base))
+	if name == "/" {
+		return "", false, fmt.Errorf("invalid image url %q", url)
+	}
+	return filepath.Join(s.Dir, name), true, nil
+}
+
+func (s *DirImageStore) Open(url string) (io.ReadCloser, error) {
+	path, ok, err := s.path(url)
+	if err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNotStored
+	}
+	return os.Open(path)
+}
+
+func (s *DirImageStore) Delete(url string) error {
+	path, ok, err := s.path(url)
+	if err != nil || !ok {
+		return err
+	}
+	err = os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package maintenance
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirImageStoreSave(t *testing.T) {
+	store := &DirImageStore{Dir: t.TempDir(), BaseURL: "https://img.example.com/files/"}
+
+	url, err := store.Save("avatars/abc.png", strings.NewReader("png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://img.example.com/files/avatars/abc.png" {
+		t.Errorf("Save() url = %q", url)
+	}
+	if data, err := os.ReadFile(filepath.Join(store.Dir, "avatars", "abc.png")); err != nil || string(data) != "png" {
+		t.Errorf("stored file = %q, %v", data, err)
+	}
+
+	if _, err := store.Save("avatars/abc.png", strings.NewReader("other")); err == nil {
+		t.Error("Save() overwrote an existing file")
+	}
+
+	// Names cannot escape Dir
+	url, err = store.Save("../../outside.png", strings.NewReader("png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://img.example.com/files/outside.png" {
+		t.Errorf("Save() url = %q", url)
+	}
+	if _, err := os.Stat(filepath.Join(store.Dir, "outside.png")); err != nil {
+		t.Errorf("file not stored inside Dir: %v", err)
+	}
+}
+
+func TestSaveRequiresConfiguration(t *testing.T) {
+	if _, err := (LogImageStore{}).Save("a.png", strings.NewReader("")); err == nil {
+		t.Error("LogImageStore.Save() succeeded")
+	}
+	if _, err := (&DirImageStore{Dir: t.TempDir()}).Save("a.png", strings.NewReader("")); err == nil {
+		t.Error("DirImageStore.Save() without BaseURL succeeded")
+	}
+}
+
+func TestDirImageStoreDelete(t *testing.T) {
+	root := t.TempDir()
+	store := &DirImageStore{Dir: filepath.Join(root, "images"), BaseURL: "https://img.example.com/files"}
+	for _, name := range []string{"images/cats/milo.jpg", "images/keep.jpg", "secret.jpg"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("jpg"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://img.example.com/files/cats/milo.jpg", true},
+		{"https://img.example.com/files/cats/milo.jpg", true},
+		{"https://img.example.com/files/missing.jpg", true},
+		{"https://img.example.com/files/../secret.jpg", true},
+		{"https://img.example.com/files/cats/../../../secret.jpg", true},
+		{"https://img.example.com/files/%2e%2e/secret.jpg", true},
+		{"https://img.example.com/files-other/keep.jpg", true},
+		{"https://other.example.com/files/keep.jpg", true},
+		{"https://img.example.com/files/", false},
+		{"https://img.example.com/files/..", false},
+	}
+	for _, tt := range tests {
+		if err := store.Delete(tt.url); (err == nil) != tt.ok {
+			t.Errorf("Delete(%q) error = %v, want ok %t", tt.url, err, tt.ok)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "images", "cats", "milo.jpg")); !os.IsNotExist(err) {
+		t.Errorf("Delete() did not remove the image: %v", err)
+	}
+	for _, name := range []string{"images/keep.jpg", "secret.jpg"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("Delete() removed %s: %v", name, err)
+		}
+	}
+}
+
+func TestDirImageStoreOpen(t *testing.T) {
+	store := &DirImageStore{Dir: t.TempDir(), BaseURL: "https://img.example.com/files"}
+	url, err := store.Save("cats/milo.jpg", strings.NewReader("jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := store.Open(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || string(data) != "jpg" {
+		t.Errorf("Open(%q) = %q, %v", url, data, err)
+	}
+
+	if _, err := store.Open("https://other.example.com/files/cats/milo.jpg"); !errors.Is(err, ErrNotStored) {
+		t.Errorf("Open() of a foreign url error = %v, want ErrNotStored", err)
+	}
+	if _, err := store.Open("https://img.example.com/files/missing.jpg"); !os.IsNotExist(err) {
+		t.Errorf("Open() of a missing image error = %v, want not exist", err)
+	}
+	if _, err := (LogImageStore{}).Open(url); !errors.Is(err, ErrNotStored) {
+		t.Errorf("LogImageStore.Open() error = %v, want ErrNotStored", err)
+	}
+}
@@ -0,0 +1,218 @@
+package maintenance
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// DefaultPurger is used by the admin purge endpoint, set by main
+var DefaultPurger *Purger
+
+// Purger hard deletes the cats, matches and users that were soft deleted
+// longer than Retention ago, along with the images and health record
+// attachments of the purged cats and the avatars of the purged users
+type Purger struct {
+	DB        *sql.DB
+	Images    ImageStore
+	Retention time.Duration
+	Interval  time.Duration
+	// DryRun makes the scheduled runs only report what they would remove
+	DryRun bool
+}
+
+// Report lists what a purge removed, or would remove on a dry run
+type Report struct {
+	DryRun        bool     `json:"dryRun"`
+	RetentionDays int      `json:"retentionDays"`
+	UserIDs       []int    `json:"userIds"`
+	CatIDs        []int    `json:"catIds"`
+	MatchIDs      []int    `json:"matchIds"`
+	Images        []string `json:"images"`
+}
+
+// PurgerFromEnv configures a purger with RETENTION_DAYS (default 90, never
+// shorter than CAT_RESTORE_GRACE_DAYS), PURGE_INTERVAL (default 24h) and
+// PURGE_DRY_RUN
+func PurgerFromEnv(db *sql.DB) (*Purger, error) {
+	p := &Purger{DB: db, Images: ImageStoreFromEnv(), Retention: 90 * 24 * time.Hour, Interval: 24 * time.Hour}
+
+	if value := os.Getenv("RETENTION_DAYS"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 {
+			return nil, fmt.Errorf("invalid RETENTION_DAYS %q", value)
+		}
+		p.Retention = time.Duration(days) * 24 * time.Hour
+	}
+	if value := os.Getenv("CAT_RESTORE_GRACE_DAYS"); value != "" {
+		if days, err := strconv.Atoi(value); err != nil || days < 1 {
+			return nil, fmt.Errorf("invalid CAT_RESTORE_GRACE_DAYS %q", value)
+		}
+	}
+	// A cat is only purged once its owner can no longer restore it
+	if p.Retention < RestoreGracePeriod() {
+		return nil, fmt.Errorf("RETENTION_DAYS must not be shorter than CAT_RESTORE_GRACE_DAYS")
+	}
+	if value := os.Getenv("PURGE_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid PURGE_INTERVAL %q", value)
+		}
+		p.Interval = interval
+	}
+	if value := os.Getenv("PURGE_DRY_RUN"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PURGE_DRY_RUN %q", value)
+		}
+		p.DryRun = dryRun
+	}
+	return p, nil
+}
+
+// RestoreGracePeriod is how long a deleted cat can be restored by its owner,
+// CAT_RESTORE_GRACE_DAYS days, 30 by default
+func RestoreGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("CAT_RESTORE_GRACE_DAYS"))
+	if err != nil || days < 1 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Start runs the purge every Interval in the background until the process exits
+func (p *Purger) Start() {
+	go func() {
+		for {
+			report, err := p.Run(p.DryRun)
+			if err != nil {
+				log.Println("Retention purge:", err)
+			} else {
+				log.Printf("Retention purge (dry run %t): %d users, %d cats, %d matches, %d images",
+					report.DryRun, len(report.UserIDs), len(report.CatIDs), len(report.MatchIDs), len(report.Images))
+			}
+			time.Sleep(p.Interval)
+		}
+	}()
+}
+
+// Run purges in one transaction, a dry run rolls it back and only reports.
+// Matches pointing at a purged cat or user are purged too, since match_cats
+// does not cascade.
+func (p *Purger) Run(dryRun bool) (*Report, error) {
+	report := &Report{DryRun: dryRun, RetentionDays: int(p.Retention / (24 * time.Hour))}
+	retention := int64(p.Retention / time.Second)
+
+	tx, err := p.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Erased users and their cats are kept anonymized as the counterpart of
+	// the matches of other users. Users still the contact of organization
+	// cats are kept, deleting them would cascade to the cats.
+	report.UserIDs, err = queryIDs(tx, `SELECT id FROM users WHERE deleted_at < NOW() - $1 * INTERVAL '1 second' AND erased_at IS NULL
+		AND NOT EXISTS(SELECT 1 FROM cats WHERE cats.user_id = users.id AND cats.organization_id IS NOT NULL) ORDER BY id FOR UPDATE`, retention)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT id, image_urls FROM cats
+		WHERE (deleted_at < NOW() - $1 * INTERVAL '1 second' AND NOT EXISTS(SELECT 1 FROM users WHERE users.id = cats.user_id AND users.erased_at IS NOT NULL))
+		OR (user_id = ANY($2) AND organization_id IS NULL) ORDER BY id FOR UPDATE`,
+		retention, pq.Array(report.UserIDs))
+	if err != nil {
+		return nil, err
+	}
+	report.CatIDs = []int{}
+	report.Images = []string{}
+	for rows.Next() {
+		var catID int
+		var images []string
+		if err := rows.Scan(&catID, pq.Array(&images)); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.CatIDs = append(report.CatIDs, catID)
+		report.Images = append(report.Images, images...)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// The avatars of the users and the attachments of the health records,
+	// which are deleted with their cats
+	files, err := tx.Query(`SELECT avatar_url FROM users WHERE id = ANY($1) AND avatar_url IS NOT NULL
+		UNION ALL SELECT attachment_url FROM health_records WHERE cat_id = ANY($2) AND attachment_url IS NOT NULL`,
+		pq.Array(report.UserIDs), pq.Array(report.CatIDs))
+	if err != nil {
+		return nil, err
+	}
+	for files.Next() {
+		var file string
+		if err := files.Scan(&file); err != nil {
+			files.Close()
+			return nil, err
+		}
+		report.Images = append(report.Images, file)
+	}
+	files.Close()
+	if err := files.Err(); err != nil {
+		return nil, err
+	}
+
+	report.MatchIDs, err = queryIDs(tx, `SELECT id FROM match_cats WHERE deleted_at < NOW() - $1 * INTERVAL '1 second'
+		OR issuedCatId = ANY($2) OR receiverCatId = ANY($2) OR issuedId = ANY($3) OR receiverId = ANY($3) ORDER BY id FOR UPDATE`,
+		retention, pq.Array(report.CatIDs), pq.Array(report.UserIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	_, err = tx.Exec("DELETE FROM match_cats WHERE id = ANY($1)", pq.Array(report.MatchIDs))
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM cats WHERE id = ANY($1)", pq.Array(report.CatIDs))
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM users WHERE id = ANY($1)", pq.Array(report.UserIDs))
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := DeleteUnreferenced(p.DB, p.Images, report.Images); err != nil {
+		log.Println("Error deleting purged cat images:", err)
+	}
+	return report, nil
+}
+
+func queryIDs(tx *sql.Tx, query string, args ...interface{}) ([]int, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,35 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgerFromEnvRetention(t *testing.T) {
+	tests := []struct {
+		retention string
+		grace     string
+		want      time.Duration
+		ok        bool
+	}{
+		{"", "", 90 * 24 * time.Hour, true},
+		{"30", "", 30 * 24 * time.Hour, true},
+		{"29", "", 0, false},
+		{"7", "7", 7 * 24 * time.Hour, true},
+		{"7", "14", 0, false},
+		{"90", "abc", 0, false},
+		{"0", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("RETENTION_DAYS", tt.retention)
+		t.Setenv("CAT_RESTORE_GRACE_DAYS", tt.grace)
+		p, err := PurgerFromEnv(nil)
+		if tt.ok != (err == nil) {
+			t.Errorf("PurgerFromEnv() with RETENTION_DAYS=%q CAT_RESTORE_GRACE_DAYS=%q error = %v, want ok %t", tt.retention, tt.grace, err, tt.ok)
+			continue
+		}
+		if tt.ok && p.Retention != tt.want {
+			t.Errorf("PurgerFromEnv() with RETENTION_DAYS=%q retention = %v, want %v", tt.retention, p.Retention, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package privacy
+
+import (
+	"CatsSocial/maintenance"
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+)
+
+// archiveFiles are the files of a personal data archive, each query returns
+// one JSON document for the user given as $1
+var archiveFiles = []struct {
+	name  string
+	query string
+}{
+	{"profile.json", `SELECT row_to_json(t) FROM (
+		SELECT id, email, name, locale, avatar_url, city, latitude, longitude, role, email_verified_at,
+			totp_enabled_at IS NOT NULL AS two_factor_enabled, suspended_at, suspension_reason, created_at, updated_at, deleted_at
+		FROM users WHERE id = $1) t`},
+	{"cats.json", `SELECT COALESCE(json_agg(t ORDER BY t.id), '[]') FROM (
+		SELECT id, name, race, sex, age_in_month, description, image_urls, sire_id, dam_id, has_matched, health_visibility,
+			hidden_at, created_at, updated_at, deleted_at
+		FROM cats WHERE user_id = $1) t`},
+	{"health_records.json", `SELECT COALESCE(json_agg(t ORDER BY t.id), '[]') FROM (
+		SELECT health_records.id, health_records.cat_id, health_records.record_type, health_records.name, health_records.performed_at,
+			health_records.valid_until, health_records.notes, health_records.attachment_url,
+			health_records.created_at, health_records.updated_at, health_records.deleted_at
+		FROM health_records JOIN cats ON cats.id = health_records.cat_id WHERE cats.user_id = $1) t`},
+	{"matches.json", `SELECT COALESCE(json_agg(t ORDER BY t.id), '[]') FROM (
+		SELECT id, issuedId AS issued_user_id, issuedCatId AS issued_cat_id, receiverId AS receiver_user_id, receiverCatId AS receiver_cat_id,
+			message, status, created_at, updated_at, deleted_at
+		FROM match_cats WHERE issuedId = $1 OR receiverId = $1) t`},
+	{"messages.json", `SELECT COALESCE(json_agg(t ORDER BY t.id), '[]') FROM (
+		SELECT match_messages.id, match_messages.match_id, match_messages.sender_id, match_messages.body,
+			match_messages.read_at, match_messages.created_at
+		FROM match_messages JOIN match_cats ON match_cats.id = match_messages.match_id
+		WHERE match_cats.issuedId = $1 OR match_cats.receiverId = $1) t`},
+}
+
+// imagesQuery lists the avatar, cat images and health record attachments of the user
+const imagesQuery = `SELECT 'avatar', NULL::INTEGER, NULL::INTEGER, avatar_url FROM users WHERE id = $1 AND avatar_url IS NOT NULL
+	UNION ALL
+	SELECT 'cat', cats.id, NULL, image.url FROM cats, unnest(cats.image_urls) AS image(url) WHERE cats.user_id = $1
+	UNION ALL
+	SELECT 'health_record', cats.id, health_records.id, health_records.attachment_url
+	FROM health_records JOIN cats ON cats.id = health_records.cat_id
+	WHERE cats.user_id = $1 AND health_records.attachment_url IS NOT NULL`
+
+// archiveImage is an entry of images.json, file is the copy in the archive
+// and is empty for images hosted outside of the image storage
+type archiveImage struct {
+	Source         string `json:"source"`
+	CatID          *int   `json:"cat_id"`
+	HealthRecordID *int   `json:"health_record_id"`
+	URL            string `json:"url"`
+	File           string `json:"file,omitempty"`
+}
+
+// WriteArchive writes the zip archive of the personal data of the user, the
+// images held by the image storage are copied into the archive
+func WriteArchive(db *sql.DB, images maintenance.ImageStore, userID int, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, file := range archiveFiles {
+		var document []byte
+		if err := db.QueryRow(file.query, userID).Scan(&document); err != nil {
+			return err
+		}
+
+		// Indent the documents so the archive is readable as is
+		var value interface{}
+		if err := json.Unmarshal(document, &value); err != nil {
+			return err
+		}
+		document, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(document); err != nil {
+			return err
+		}
+	}
+	if err := writeImages(db, images, userID, archive); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeImages(db *sql.DB, images maintenance.ImageStore, userID int, archive *zip.Writer) error {
+	rows, err := db.Query(imagesQuery, userID)
+	if err != nil {
+		return err
+	}
+	var list []archiveImage
+	for rows.Next() {
+		var image archiveImage
+		if err := rows.Scan(&image.Source, &image.CatID, &image.HealthRecordID, &image.URL); err != nil {
+			rows.Close()
+			return err
+		}
+		list = append(list, image)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// An image used more than once is copied once
+	files := map[string]string{}
+	for i, image := range list {
+		file, copied := files[image.URL]
+		if !copied {
+			file, err = copyImage(images, image.URL, fmt.Sprintf("images/%d%s", len(files)+1, path.Ext(image.URL)), archive)
+			if err != nil {
+				return err
+			}
+			files[image.URL] = file
+		}
+		list[i].File = file
+	}
+
+	if list == nil {
+		list = []archiveImage{}
+	}
+	document, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := archive.Create("images.json")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(document)
+	return err
+}
+
+// copyImage adds the image to the archive as name, it returns an empty name
+// when the image is not in the image storage
+func copyImage(images maintenance.ImageStore, url, name string, archive *zip.Writer) (string, error) {
+	r, err := images.Open(url)
+	if errors.Is(err, maintenance.ErrNotStored) || errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	f, err := archive.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return "", err
+	}
+	return name, nil
+}
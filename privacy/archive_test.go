@@ -0,0 +1,55 @@
+package privacy
+
+import (
+	"CatsSocial/maintenance"
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCopyImage(t *testing.T) {
+	store := &maintenance.DirImageStore{Dir: t.TempDir(), BaseURL: "https://img.example.com/files"}
+	url, err := store.Save("avatars/budi.png", strings.NewReader("png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	tests := []struct {
+		url  string
+		name string
+		want string
+	}{
+		{url, "images/1.png", "images/1.png"},
+		{"https://img.example.com/files/avatars/missing.png", "images/2.png", ""},
+		{"https://cdn.example.com/cat.jpg", "images/3.jpg", ""},
+	}
+	for _, tt := range tests {
+		got, err := copyImage(store, tt.url, tt.name, archive)
+		if err != nil || got != tt.want {
+			t.Errorf("copyImage(%q) = %q, %v, want %q", tt.url, got, err, tt.want)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != 1 || reader.File[0].Name != "images/1.png" {
+		t.Fatalf("archive files = %v, want only images/1.png", reader.File)
+	}
+	f, err := reader.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if data, err := io.ReadAll(f); err != nil || string(data) != "png" {
+		t.Errorf("images/1.png = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,145 @@
+package privacy
+
+import (
+	"CatsSocial/maintenance"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A claimed export is built again after this lease when the process dies mid-build
+const claimLease = 30 * time.Minute
+
+// Exporter builds the requested data exports in the background
+type Exporter struct {
+	DB           *sql.DB
+	Images       maintenance.ImageStore
+	Dir          string
+	PollInterval time.Duration
+	// TTL is how long an archive can be downloaded before it is removed
+	TTL time.Duration
+	// OnReady is called after the archive of an export is built
+	OnReady func(userID, exportID int)
+}
+
+// NewExporter stores the archives in EXPORT_DIR, "exports" by default
+func NewExporter(db *sql.DB) (*Exporter, error) {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = "exports"
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &Exporter{DB: db, Images: maintenance.ImageStoreFromEnv(), Dir: dir, PollInterval: 10 * time.Second, TTL: 7 * 24 * time.Hour}, nil
+}
+
+// Start runs the exporter in the background until the process exits
+func (e *Exporter) Start() {
+	go func() {
+		for {
+			if err := e.RunOnce(); err != nil {
+				log.Println("Data exporter:", err)
+			}
+			time.Sleep(e.PollInterval)
+		}
+	}()
+}
+
+// RunOnce removes the expired archives and builds the pending exports
+func (e *Exporter) RunOnce() error {
+	if err := e.expire(); err != nil {
+		return err
+	}
+	for {
+		built, err := e.buildNext()
+		if err != nil || !built {
+			return err
+		}
+	}
+}
+
+func (e *Exporter) buildNext() (bool, error) {
+	var exportID, userID int
+	err := e.DB.QueryRow(`UPDATE data_exports SET status = 'processing', claimed_at = NOW()
+		WHERE id = (SELECT id FROM data_exports
+			WHERE status = 'pending' OR (status = 'processing' AND claimed_at < NOW() - $1 * INTERVAL '1 second')
+			ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED)
+		RETURNING id, user_id`, int64(claimLease/time.Second)).Scan(&exportID, &userID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	path := filepath.Join(e.Dir, fmt.Sprintf("export-%d.zip", exportID))
+	if err := e.build(userID, path); err != nil {
+		log.Println("Error building data export:", err)
+		os.Remove(path)
+		_, err = e.DB.Exec("UPDATE data_exports SET status = 'failed', error = $1, completed_at = NOW() WHERE id = $2", err.Error(), exportID)
+		return err == nil, err
+	}
+
+	result, err := e.DB.Exec("UPDATE data_exports SET status = 'ready', file_path = $1, completed_at = NOW(), expires_at = NOW() + $2 * INTERVAL '1 second' WHERE id = $3",
+		path, int64(e.TTL/time.Second), exportID)
+	if err != nil {
+		RemoveArchive(path)
+		return false, err
+	}
+
+	// The export is gone when the account was erased during the build,
+	// nothing would track or remove the archive
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		RemoveArchive(path)
+		return err == nil, err
+	}
+	if e.OnReady != nil {
+		e.OnReady(userID, exportID)
+	}
+	return true, nil
+}
+
+func (e *Exporter) build(userID int, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := WriteArchive(e.DB, e.Images, userID, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (e *Exporter) expire() error {
+	rows, err := e.DB.Query(`UPDATE data_exports SET status = 'expired', file_path = NULL
+		FROM (SELECT id, file_path FROM data_exports WHERE status = 'ready' AND expires_at < NOW() FOR UPDATE) expired
+		WHERE data_exports.id = expired.id
+		RETURNING expired.file_path`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var path sql.NullString
+		if err := rows.Scan(&path); err != nil {
+			return err
+		}
+		RemoveArchive(path.String)
+	}
+	return rows.Err()
+}
+
+// RemoveArchive deletes the archive file of an export, if any
+func RemoveArchive(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Println("Error removing data export:", err)
+	}
+}
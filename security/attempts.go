@@ -0,0 +1,127 @@
+package security
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AttemptStore counts the failed attempts of a key, like an account or an IP
+// address. Counters are forgotten after the window of the store has passed
+// without a new failure.
+type AttemptStore interface {
+	// Failures returns the failure count of the key and the time of the last failure
+	Failures(key string) (int, time.Time, error)
+	// RecordFailure adds a failure and returns the new count
+	RecordFailure(key string) (int, error)
+	Reset(key string) error
+}
+
+// StoreFromEnv returns the store selected by LOGIN_ATTEMPT_STORE, "memory"
+// (the default, per instance) or "postgres" (shared by every instance)
+func StoreFromEnv(db *sql.DB) (AttemptStore, error) {
+	switch strings.ToLower(os.Getenv("LOGIN_ATTEMPT_STORE")) {
+	case "", "memory":
+		return NewMemoryStore(DefaultWindow), nil
+	case "postgres":
+		return NewPostgresStore(db, DefaultWindow), nil
+	default:
+		return nil, fmt.Errorf("unknown LOGIN_ATTEMPT_STORE %q", os.Getenv("LOGIN_ATTEMPT_STORE"))
+	}
+}
+
+// DefaultWindow is how long failures are remembered
+const DefaultWindow = 24 * time.Hour
+
+type attempt struct {
+	failures    int
+	lastFailure time.Time
+}
+
+// MemoryStore keeps the counters in the memory of this instance
+type MemoryStore struct {
+	mu       sync.Mutex
+	window   time.Duration
+	attempts map[string]attempt
+}
+
+func NewMemoryStore(window time.Duration) *MemoryStore {
+	return &MemoryStore{window: window, attempts: map[string]attempt{}}
+}
+
+func (s *MemoryStore) Failures(key string) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.attempts[key]
+	if !ok || time.Since(a.lastFailure) > s.window {
+		return 0, time.Time{}, nil
+	}
+	return a.failures, a.lastFailure, nil
+}
+
+func (s *MemoryStore) RecordFailure(key string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	// Drop expired counters while the lock is held so the map stays small
+	for k, a := range s.attempts {
+		if now.Sub(a.lastFailure) > s.window {
+			delete(s.attempts, k)
+		}
+	}
+	a := s.attempts[key]
+	a.failures++
+	a.lastFailure = now
+	s.attempts[key] = a
+	return a.failures, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// PostgresStore keeps the counters in the login_attempts table
+type PostgresStore struct {
+	db     *sql.DB
+	window time.Duration
+}
+
+func NewPostgresStore(db *sql.DB, window time.Duration) *PostgresStore {
+	return &PostgresStore{db: db, window: window}
+}
+
+func (s *PostgresStore) Failures(key string) (int, time.Time, error) {
+	// The age is computed by the database so both clocks never get compared
+	var failures int
+	var ageSeconds float64
+	err := s.db.QueryRow("SELECT failures, EXTRACT(EPOCH FROM NOW() - last_failure_at) FROM login_attempts WHERE key = $1 AND last_failure_at > NOW() - $2 * INTERVAL '1 second'",
+		key, int(s.window.Seconds())).Scan(&failures, &ageSeconds)
+	if err == sql.ErrNoRows {
+		return 0, time.Time{}, nil
+	} else if err != nil {
+		return 0, time.Time{}, err
+	}
+	return failures, time.Now().Add(-time.Duration(ageSeconds * float64(time.Second))), nil
+}
+
+func (s *PostgresStore) RecordFailure(key string) (int, error) {
+	var failures int
+	err := s.db.QueryRow(`INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at > NOW() - $2 * INTERVAL '1 second' THEN login_attempts.failures + 1 ELSE 1 END,
+			last_failure_at = NOW()
+		RETURNING failures`, key, int(s.window.Seconds())).Scan(&failures)
+	return failures, err
+}
+
+func (s *PostgresStore) Reset(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
@@ -0,0 +1,86 @@
+package security
+
+import (
+	"time"
+)
+
+// Limiter applies a progressive delay to failed attempts and locks a key
+// once it reaches its threshold. Every further failure doubles the lockout.
+type Limiter struct {
+	Store AttemptStore
+	// DelayStep is the delay after the second failure, doubled after each
+	// failure up to MaxDelay
+	DelayStep   time.Duration
+	MaxDelay    time.Duration
+	LockoutBase time.Duration
+	MaxLockout  time.Duration
+}
+
+// DefaultLimiter is used by Login, it is set by main
+var DefaultLimiter = NewLimiter(NewMemoryStore(DefaultWindow))
+
+func NewLimiter(store AttemptStore) *Limiter {
+	return &Limiter{
+		Store:       store,
+		DelayStep:   250 * time.Millisecond,
+		MaxDelay:    4 * time.Second,
+		LockoutBase: time.Minute,
+		MaxLockout:  time.Hour,
+	}
+}
+
+// Delay returns the wait applied before answering the given failure count
+func (l *Limiter) Delay(failures int) time.Duration {
+	if failures < 2 {
+		return 0
+	}
+	delay := l.DelayStep
+	for i := 2; i < failures && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.MaxDelay {
+		delay = l.MaxDelay
+	}
+	return delay
+}
+
+// Lockout returns how long a key is locked after the given failure count
+func (l *Limiter) Lockout(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	lockout := l.LockoutBase
+	for i := threshold; i < failures && lockout < l.MaxLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > l.MaxLockout {
+		lockout = l.MaxLockout
+	}
+	return lockout
+}
+
+// RetryAfter returns how long the key stays locked, zero when it is not
+func (l *Limiter) RetryAfter(key string, threshold int) (time.Duration, error) {
+	failures, lastFailure, err := l.Store.Failures(key)
+	if err != nil {
+		return 0, err
+	}
+	remaining := time.Until(lastFailure.Add(l.Lockout(failures, threshold)))
+	if remaining < 0 {
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+// Fail records a failure of the key and returns the delay to apply
+func (l *Limiter) Fail(key string) (time.Duration, error) {
+	failures, err := l.Store.RecordFailure(key)
+	if err != nil {
+		return 0, err
+	}
+	return l.Delay(failures), nil
+}
+
+func (l *Limiter) Reset(key string) error {
+	return l.Store.Reset(key)
+}
@@ -0,0 +1,122 @@
+package security
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+
+	for want := 1; want <= 3; want++ {
+		if got, err := store.RecordFailure("account:budi"); err != nil || got != want {
+			t.Fatalf("RecordFailure() = %d, %v, want %d", got, err, want)
+		}
+	}
+	if failures, last, _ := store.Failures("account:budi"); failures != 3 || time.Since(last) > time.Second {
+		t.Errorf("Failures() = %d, %v, want 3 just now", failures, last)
+	}
+	if failures, _, _ := store.Failures("ip:127.0.0.1"); failures != 0 {
+		t.Errorf("Failures() of another key = %d, want 0", failures)
+	}
+
+	store.Reset("account:budi")
+	if failures, _, _ := store.Failures("account:budi"); failures != 0 {
+		t.Errorf("Failures() after Reset() = %d, want 0", failures)
+	}
+}
+
+func TestMemoryStoreWindow(t *testing.T) {
+	store := NewMemoryStore(time.Hour)
+	store.RecordFailure("account:budi")
+	store.RecordFailure("account:budi")
+
+	// Age the counter past the window
+	store.attempts["account:budi"] = attempt{failures: 2, lastFailure: time.Now().Add(-2 * time.Hour)}
+	if failures, _, _ := store.Failures("account:budi"); failures != 0 {
+		t.Errorf("Failures() after the window = %d, want 0", failures)
+	}
+	if failures, _ := store.RecordFailure("account:budi"); failures != 1 {
+		t.Errorf("RecordFailure() after the window = %d, want a new count of 1", failures)
+	}
+
+	// Expired counters of other keys are dropped
+	store.attempts["ip:10.0.0.1"] = attempt{failures: 5, lastFailure: time.Now().Add(-2 * time.Hour)}
+	store.RecordFailure("account:budi")
+	if _, ok := store.attempts["ip:10.0.0.1"]; ok {
+		t.Error("RecordFailure() kept an expired counter")
+	}
+}
+
+func TestLimiterDelay(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(DefaultWindow))
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 250 * time.Millisecond},
+		{3, 500 * time.Millisecond},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{20, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := l.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(DefaultWindow))
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{4, 0},
+		{5, time.Minute},
+		{6, 2 * time.Minute},
+		{8, 8 * time.Minute},
+		{11, time.Hour},
+		{100, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := l.Lockout(tt.failures, 5); got != tt.want {
+			t.Errorf("Lockout(%d, 5) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterRetryAfter(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(DefaultWindow))
+	const threshold = 3
+
+	for i := 1; i < threshold; i++ {
+		l.Fail("account:budi")
+		if remaining, err := l.RetryAfter("account:budi", threshold); err != nil || remaining != 0 {
+			t.Fatalf("RetryAfter() after %d failures = %v, %v, want unlocked", i, remaining, err)
+		}
+	}
+
+	delay, err := l.Fail("account:budi")
+	if err != nil || delay != 500*time.Millisecond {
+		t.Errorf("Fail() = %v, %v, want 500ms", delay, err)
+	}
+	remaining, err := l.RetryAfter("account:budi", threshold)
+	if err != nil || remaining <= 59*time.Second || remaining > time.Minute {
+		t.Errorf("RetryAfter() after the threshold = %v, %v, want about a minute", remaining, err)
+	}
+
+	// The lockout runs from the last failure
+	l.Store.(*MemoryStore).attempts["account:budi"] = attempt{failures: threshold, lastFailure: time.Now().Add(-2 * time.Minute)}
+	if remaining, _ := l.RetryAfter("account:budi", threshold); remaining != 0 {
+		t.Errorf("RetryAfter() after the lockout = %v, want 0", remaining)
+	}
+
+	l.Reset("account:budi")
+	if remaining, _ := l.RetryAfter("account:budi", threshold); remaining != 0 {
+		t.Errorf("RetryAfter() after Reset() = %v, want 0", remaining)
+	}
+}
@@ -0,0 +1,106 @@
+package security
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the RFC 4226 and RFC 6238 SHA1 test key "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		got, err := HOTP(rfcSecret, int64(counter))
+		if err != nil || got != code {
+			t.Errorf("HOTP(%d) = %q, %v, want %q", counter, got, err, code)
+		}
+	}
+
+	// Secrets are accepted in lower case and with padding
+	if got, err := HOTP(strings.ToLower(rfcSecret)+"====", 0); err != nil || got != "755224" {
+		t.Errorf("HOTP() of a lower case padded secret = %q, %v", got, err)
+	}
+	if _, err := HOTP("not base32!", 0); err == nil {
+		t.Error("HOTP() accepted an invalid secret")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	// RFC 6238 appendix B SHA1 vectors, truncated to the last 6 of 8 digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		now := time.Unix(tt.unix, 0)
+		step, ok := VerifyTOTP(rfcSecret, tt.code, now)
+		if !ok || step != tt.unix/TOTPPeriod {
+			t.Errorf("VerifyTOTP(%q, %d) = %d, %t, want step %d", tt.code, tt.unix, step, ok, tt.unix/TOTPPeriod)
+		}
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := TOTPStep(now)
+	tests := []struct {
+		step int64
+		ok   bool
+	}{
+		{current - 2, false},
+		{current - 1, true},
+		{current, true},
+		{current + 1, true},
+		{current + 2, false},
+	}
+	for _, tt := range tests {
+		code, err := HOTP(rfcSecret, tt.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := VerifyTOTP(rfcSecret, code[:3]+" "+code[3:], now)
+		if ok != tt.ok || (ok && step != tt.step) {
+			t.Errorf("VerifyTOTP() of step %+d = %d, %t, want %t", tt.step-current, step, ok, tt.ok)
+		}
+	}
+
+	for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, ok := VerifyTOTP(rfcSecret, code, now); ok {
+			t.Errorf("VerifyTOTP(%q) accepted the code", code)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("CatsSocial", "budi@example.com", rfcSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/CatsSocial:budi@example.com" ||
+		query.Get("secret") != rfcSecret || query.Get("issuer") != "CatsSocial" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("TOTPURI() = %s", uri)
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("GenerateTOTPSecret() = %q, %d bytes, %v", secret, len(key), err)
+	}
+}
@@ -0,0 +1,249 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAttempts = 8
+	batchSize   = 20
+	// A claimed delivery is retried after this lease when the process dies mid-request
+	claimLease = 5 * time.Minute
+)
+
+// Dispatcher moves outbox events into deliveries and sends them with retries
+type Dispatcher struct {
+	DB           *sql.DB
+	Client       *http.Client
+	PollInterval time.Duration
+	// RetryBase is the first retry delay, doubled after every failed attempt
+	RetryBase time.Duration
+}
+
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:           db,
+		Client:       NewClient(),
+		PollInterval: 5 * time.Second,
+		RetryBase:    30 * time.Second,
+	}
+}
+
+// Start runs the dispatcher in the background until the process exits
+func (d *Dispatcher) Start() {
+	go func() {
+		for {
+			if err := d.RunOnce(); err != nil {
+				log.Println("Webhook dispatcher:", err)
+			}
+			time.Sleep(d.PollInterval)
+		}
+	}()
+}
+
+// RunOnce fans out pending outbox events and sends the deliveries that are due
+func (d *Dispatcher) RunOnce() error {
+	if err := d.fanOut(); err != nil {
+		return err
+	}
+	return d.deliverDue()
+}
+
+// Sign returns the value of the X-CatSocial-Signature header, an HMAC-SHA256
+// of "<timestamp>.<body>" so receivers can reject replayed payloads
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay returns the delay before the next attempt after the given number of attempts
+func (d *Dispatcher) RetryDelay(attempts int) time.Duration {
+	return d.RetryBase * time.Duration(1<<uint(attempts-1))
+}
+
+func (d *Dispatcher) fanOut() error {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, event_type FROM webhook_outbox WHERE processed_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED", batchSize)
+	if err != nil {
+		return err
+	}
+	type outboxEvent struct {
+		id        int
+		eventType string
+	}
+	var pending []outboxEvent
+	for rows.Next() {
+		var event outboxEvent
+		if err := rows.Scan(&event.id, &event.eventType); err != nil {
+			rows.Close()
+			return err
+		}
+		pending = append(pending, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, event := range pending {
+		// An empty events list subscribes the webhook to every event
+		_, err = tx.Exec(`INSERT INTO webhook_deliveries (webhook_id, outbox_id, event_type)
+			SELECT w.id, o.id, o.event_type FROM webhook_outbox o
+			INNER JOIN webhooks w ON w.deleted_at IS NULL AND (w.is_global OR w.user_id = ANY(o.user_ids))
+				AND (cardinality(w.events) = 0 OR o.event_type = ANY(w.events))
+			WHERE o.id = $1`, event.id)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec("UPDATE webhook_outbox SET processed_at = NOW() WHERE id = $1", event.id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type delivery struct {
+	id        int
+	outboxID  int
+	eventType string
+	attempts  int
+	url       string
+	secret    string
+	payload   []byte
+	createdAt time.Time
+}
+
+func (d *Dispatcher) deliverDue() error {
+	rows, err := d.DB.Query(`UPDATE webhook_deliveries wd SET next_attempt_at = NOW() + $2 * INTERVAL '1 second'
+		FROM webhooks w, webhook_outbox o
+		WHERE wd.id IN (
+			SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= NOW()
+				AND EXISTS(SELECT 1 FROM webhooks WHERE webhooks.id = webhook_id AND webhooks.deleted_at IS NULL)
+			ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED
+		) AND w.id = wd.webhook_id AND w.deleted_at IS NULL AND o.id = wd.outbox_id
+		RETURNING wd.id, wd.outbox_id, wd.event_type, wd.attempts, w.url, w.secret, o.payload, o.created_at`,
+		batchSize, int(claimLease.Seconds()))
+	if err != nil {
+		return err
+	}
+	var due []delivery
+	for rows.Next() {
+		var dl delivery
+		if err := rows.Scan(&dl.id, &dl.outboxID, &dl.eventType, &dl.attempts, &dl.url, &dl.secret, &dl.payload, &dl.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		due = append(due, dl)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, dl := range due {
+		result := d.attempt(dl)
+		switch result.status {
+		case "succeeded":
+			_, err = d.DB.Exec("UPDATE webhook_deliveries SET status = 'succeeded', attempts = $1, last_status_code = $2, last_error = NULL, delivered_at = NOW(), updated_at = NOW() WHERE id = $3",
+				result.attempts, result.statusCode, dl.id)
+		case "failed":
+			_, err = d.DB.Exec("UPDATE webhook_deliveries SET status = 'failed', attempts = $1, last_status_code = $2, last_error = $3, updated_at = NOW() WHERE id = $4",
+				result.attempts, nullStatusCode(result.statusCode), result.err.Error(), dl.id)
+		default:
+			_, err = d.DB.Exec("UPDATE webhook_deliveries SET attempts = $1, last_status_code = $2, last_error = $3, next_attempt_at = NOW() + $4 * INTERVAL '1 second', updated_at = NOW() WHERE id = $5",
+				result.attempts, nullStatusCode(result.statusCode), result.err.Error(), int(result.retryIn.Seconds()), dl.id)
+		}
+		if err != nil {
+			log.Println("Error updating webhook delivery:", err)
+		}
+	}
+
+	return nil
+}
+
+// attemptResult is the state of a delivery after an attempt
+type attemptResult struct {
+	// status is pending, succeeded or failed
+	status     string
+	attempts   int
+	statusCode int
+	err        error
+	// retryIn is the delay before the next attempt of a pending delivery
+	retryIn time.Duration
+}
+
+// attempt sends the delivery once and decides whether it is retried
+func (d *Dispatcher) attempt(dl delivery) attemptResult {
+	result := attemptResult{status: "pending", attempts: dl.attempts + 1}
+	result.statusCode, result.err = d.send(dl)
+	if result.err == nil {
+		result.status = "succeeded"
+	} else if result.attempts >= maxAttempts {
+		result.status = "failed"
+	} else {
+		result.retryIn = d.RetryDelay(result.attempts)
+	}
+	return result
+}
+
+func (d *Dispatcher) send(dl delivery) (int, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":        strconv.Itoa(dl.outboxID),
+		"event":     dl.eventType,
+		"createdAt": dl.createdAt.Format(time.RFC3339),
+		"data":      json.RawMessage(dl.payload),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, dl.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CatsSocial-Webhook/1.0")
+	req.Header.Set("X-CatSocial-Event", dl.eventType)
+	req.Header.Set("X-CatSocial-Delivery", strconv.Itoa(dl.id))
+	req.Header.Set("X-CatSocial-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-CatSocial-Signature", Sign(dl.secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func nullStatusCode(statusCode int) interface{} {
+	if statusCode == 0 {
+		return nil
+	}
+	return statusCode
+}
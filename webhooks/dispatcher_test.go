@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// receiver is a local webhook endpoint failing the first failures requests
+func receiver(t *testing.T, secret string, failures int32) (*httptest.Server, *int32) {
+	var received int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&received, 1)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-CatSocial-Timestamp"), 10, 64)
+		if err != nil {
+			t.Errorf("invalid timestamp header: %v", err)
+		}
+		if got, want := r.Header.Get("X-CatSocial-Signature"), Sign(secret, timestamp, body); got != want {
+			t.Errorf("signature = %q, want %q", got, want)
+		}
+		if got := r.Header.Get("X-CatSocial-Event"); got != MatchApproved {
+			t.Errorf("event header = %q, want %q", got, MatchApproved)
+		}
+		var payload struct {
+			ID    string          `json:"id"`
+			Event string          `json:"event"`
+			Data  json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil || payload.ID != "42" || string(payload.Data) != `{"matchId":"7"}` {
+			t.Errorf("unexpected payload %s", body)
+		}
+
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+func testDelivery(url string) delivery {
+	return delivery{
+		id:        1,
+		outboxID:  42,
+		eventType: MatchApproved,
+		url:       url,
+		secret:    "secret",
+		payload:   []byte(`{"matchId":"7"}`),
+		createdAt: time.Now(),
+	}
+}
+
+func TestAttemptRetriesUntilDelivered(t *testing.T) {
+	server, received := receiver(t, "secret", 2)
+	d := &Dispatcher{Client: server.Client(), RetryBase: 30 * time.Second}
+
+	dl := testDelivery(server.URL)
+	wantDelays := []time.Duration{30 * time.Second, 60 * time.Second}
+	for _, want := range wantDelays {
+		result := d.attempt(dl)
+		if result.status != "pending" || result.statusCode != http.StatusServiceUnavailable || result.retryIn != want {
+			t.Fatalf("attempt %d = %+v, want pending retried in %v", result.attempts, result, want)
+		}
+		dl.attempts = result.attempts
+	}
+
+	result := d.attempt(dl)
+	if result.status != "succeeded" || result.attempts != 3 || result.statusCode != http.StatusNoContent {
+		t.Fatalf("attempt = %+v, want succeeded after 3 attempts", result)
+	}
+	if got := atomic.LoadInt32(received); got != 3 {
+		t.Errorf("receiver got %d requests, want 3", got)
+	}
+}
+
+func TestAttemptFailsAfterMaxAttempts(t *testing.T) {
+	server, _ := receiver(t, "secret", maxAttempts)
+	d := &Dispatcher{Client: server.Client(), RetryBase: time.Second}
+
+	dl := testDelivery(server.URL)
+	dl.attempts = maxAttempts - 1
+	if result := d.attempt(dl); result.status != "failed" || result.err == nil {
+		t.Fatalf("attempt = %+v, want failed", result)
+	}
+}
+
+func TestNewClientRefusesInternalAddresses(t *testing.T) {
+	server, received := receiver(t, "secret", 0)
+	d := &Dispatcher{Client: NewClient(), RetryBase: time.Second}
+
+	result := d.attempt(testDelivery(server.URL))
+	if result.status != "pending" || !errors.Is(result.err, ErrForbiddenAddress) {
+		t.Fatalf("attempt = %+v, want refused connection", result)
+	}
+	if got := atomic.LoadInt32(received); got != 0 {
+		t.Errorf("receiver got %d requests, want 0", got)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"ftp://8.8.8.8/hook", false},
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://localhost/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://192.168.1.1/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://[::ffff:127.0.0.1]/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"https://8.8.8.8/hook", true},
+	}
+	for _, tt := range tests {
+		if err := CheckURL(tt.url); (err == nil) != tt.valid {
+			t.Errorf("CheckURL(%q) = %v, want valid %v", tt.url, err, tt.valid)
+		}
+	}
+}
+
+func TestIsForbiddenIP(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.0.1", "169.254.169.254", "::1", "fe80::1", "fc00::1", "0.0.0.0", "::"} {
+		if !isForbiddenIP(net.ParseIP(addr)) {
+			t.Errorf("isForbiddenIP(%s) = false", addr)
+		}
+	}
+	for _, addr := range []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111"} {
+		if isForbiddenIP(net.ParseIP(addr)) {
+			t.Errorf("isForbiddenIP(%s) = true", addr)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package webhooks
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+)
+
+const (
+	CatCreated    = "cat.created"
+	CatDeleted    = "cat.deleted"
+	MatchCreated  = "match.created"
+	MatchApproved = "match.approved"
+	MatchRejected = "match.rejected"
+)
+
+// EventTypes lists every event a webhook can subscribe to
+var EventTypes = []string{CatCreated, CatDeleted, MatchCreated, MatchApproved, MatchRejected}
+
+// Execer is implemented by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue stores the event in the outbox. Pass the transaction of the change
+// that caused the event so both are committed or rolled back together.
+// userIDs are the users whose webhooks receive the event.
+func Enqueue(db Execer, eventType string, userIDs []int, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO webhook_outbox (event_type, user_ids, payload) VALUES ($1, $2, $3)", eventType, pq.Array(userIDs), string(payload))
+	return err
+}